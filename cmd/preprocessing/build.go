@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Rebuilds the sqlite database from the NDJSON in db/, the NDJSON is the source
+of truth. Every ID column is checked against its lookup table before anything
+is written, 0 means unset. Parents missing from the NDJSON are inferred
+from title and system, versions missing from it are parsed from the name.
+Every system needs an entry in rdb.ZaparooSystemIDs matching its zaparoo_id,
+or an empty zaparoo_id and an entry in rdb.ZaparooUnsupported.
+Rows are inserted in ID order so the same NDJSON always builds the same
+database, the date is only stored when supplied.
+The manifest is refreshed after every successful build.
+*/
+
+const maxBuildProblems = 50
+
+var buildMetaTables = []string{
+	sqlite.TableLanguage,
+	sqlite.TablePublisher,
+	sqlite.TableDeveloper,
+	sqlite.TableGenre,
+	sqlite.TableFranchise,
+	sqlite.TableFileExtension,
+	sqlite.TableUniqueType,
+	sqlite.TableWork,
+}
+
+func build(date string, noSearch bool) {
+	if !sqlite.FTS5Enabled && !noSearch {
+		fmt.Println("Cannot build the search index,", sqlite.ErrNoFTS5, "or pass -nosearch to build without it")
+		return
+	}
+
+	db, err := sqlite.OpenMemoryZTDB()
+	if err != nil {
+		fmt.Println("Unable to Open memory DB", err)
+		return
+	}
+	defer db.Close()
+
+	problems := make([]string, 0)
+	problem := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+	sort.SliceStable(systems, func(i, j int) bool {
+		return systems[i].ID < systems[j].ID
+	})
+	systemIDs := make(map[int]bool, len(systems))
+	for _, system := range systems {
+		if systemIDs[system.ID] {
+			problem("%v: duplicate ID %v", sqlite.TableSystem, system.ID)
+		}
+		systemIDs[system.ID] = true
+		zaparooID, ok := rdb.ZaparooSystemID(system.Name)
+		if !ok {
+			problem("%v: %v has no Zaparoo system mapping", sqlite.TableSystem, system.Name)
+		} else if system.ZaparooSystemID != zaparooID {
+			problem("%v: %v has zaparoo_id %q, mapped to %q, run -cmd mapsystems", sqlite.TableSystem, system.Name, system.ZaparooSystemID, zaparooID)
+		}
+	}
+	for _, name := range rdb.RBDNames {
+		if _, ok := rdb.ZaparooSystemID(name); !ok {
+			problem("%v: %v has no Zaparoo system mapping", sqlite.TableSystem, name)
+		}
+	}
+	for name, zaparooID := range rdb.ZaparooSystemIDs {
+		if zaparooID == "" {
+			problem("%v: %v is mapped to an empty Zaparoo system, list it in rdb.ZaparooUnsupported", sqlite.TableSystem, name)
+		}
+		if slices.Contains(rdb.ZaparooUnsupported, name) {
+			problem("%v: %v is both mapped and unsupported", sqlite.TableSystem, name)
+		}
+	}
+
+	// Tables without NDJSON are left empty and their IDs aren't validated
+	metas := make(map[string][]ztdb.GenericDBMeta)
+	metaIDs := make(map[string]map[int]bool)
+	for _, table := range buildMetaTables {
+		rows, err := ztdb.LoadNDJSON(table, make([]ztdb.GenericDBMeta, 0))
+		if os.IsNotExist(err) {
+			fmt.Println("No NDJSON for", table, "IDs not validated")
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", table, err)
+			return
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].ID < rows[j].ID
+		})
+		ids := make(map[int]bool, len(rows))
+		for _, row := range rows {
+			if ids[row.ID] {
+				problem("%v: duplicate ID %v", table, row.ID)
+			}
+			ids[row.ID] = true
+		}
+		metas[table] = rows
+		metaIDs[table] = ids
+	}
+
+	// A name, ISO code or alias names one region, parents can't loop
+	regions, err := ztdb.LoadNDJSON(sqlite.TableRegion, make([]ztdb.Region, 0))
+	if os.IsNotExist(err) {
+		fmt.Println("No NDJSON for", sqlite.TableRegion, "IDs not validated")
+	} else if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableRegion, err)
+		return
+	} else {
+		sort.SliceStable(regions, func(i, j int) bool {
+			return regions[i].ID < regions[j].ID
+		})
+		regionIDs := make(map[int]bool, len(regions))
+		regionParents := make(map[int]int, len(regions))
+		regionNames := make(map[string]int)
+		for _, r := range regions {
+			if regionIDs[r.ID] {
+				problem("%v: duplicate ID %v", sqlite.TableRegion, r.ID)
+			}
+			regionIDs[r.ID] = true
+			regionParents[r.ID] = r.ParentRegionID
+			for _, name := range r.Names() {
+				if id, ok := regionNames[name]; ok && id != r.ID {
+					problem("%v: %q names both region %v and %v, run -cmd migrateregions", sqlite.TableRegion, name, id, r.ID)
+				}
+				regionNames[name] = r.ID
+			}
+		}
+		for _, r := range regions {
+			if r.ParentRegionID != 0 && !regionIDs[r.ParentRegionID] {
+				problem("%v: region %v has unknown ParentRegionID %v", sqlite.TableRegion, r.ID, r.ParentRegionID)
+				continue
+			}
+			seen := make(map[int]bool)
+			for id := r.ParentRegionID; id != 0 && !seen[id]; id = regionParents[id] {
+				if id == r.ID {
+					problem("%v: region %v is inside itself", sqlite.TableRegion, r.ID)
+					break
+				}
+				seen[id] = true
+			}
+		}
+		metaIDs[sqlite.TableRegion] = regionIDs
+	}
+
+	// Titles are required, every title belongs to a work
+	titles, err := ztdb.LoadNDJSON(sqlite.TableTitle, make([]ztdb.Title, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitle, err)
+		return
+	}
+	sort.SliceStable(titles, func(i, j int) bool {
+		return titles[i].ID < titles[j].ID
+	})
+	titleIDs := make(map[int]bool, len(titles))
+	for _, t := range titles {
+		if titleIDs[t.ID] {
+			problem("%v: duplicate ID %v", sqlite.TableTitle, t.ID)
+		}
+		titleIDs[t.ID] = true
+		if t.WorkID == 0 {
+			problem("%v: title %v has no work, run -cmd makeworks", sqlite.TableTitle, t.ID)
+		} else if ids, ok := metaIDs[sqlite.TableWork]; ok && !ids[t.WorkID] {
+			problem("%v: title %v has unknown WorkID %v", sqlite.TableTitle, t.ID, t.WorkID)
+		}
+	}
+	metaIDs[sqlite.TableTitle] = titleIDs
+
+	tvs := make([]ztdb.TitleVariant, 0)
+	for _, system := range systems {
+		systemTvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		for _, tv := range systemTvs {
+			if tv.SystemID != system.ID {
+				problem("%v: TitleVariant %v has SystemID %v, expected %v", system.Name, tv.ID, tv.SystemID, system.ID)
+			}
+		}
+		tvs = append(tvs, systemTvs...)
+	}
+	sort.SliceStable(tvs, func(i, j int) bool {
+		return tvs[i].ID < tvs[j].ID
+	})
+
+	tvIDs := make(map[int]bool, len(tvs))
+	for _, tv := range tvs {
+		if tvIDs[tv.ID] {
+			problem("%v: duplicate ID %v", sqlite.TableTitleVariant, tv.ID)
+		}
+		tvIDs[tv.ID] = true
+		refs := []struct {
+			column string
+			table  string
+			id     int
+		}{
+			{"TitleID", sqlite.TableTitle, tv.TitleID},
+			{"RegionID", sqlite.TableRegion, tv.RegionID},
+			{"PublisherID", sqlite.TablePublisher, tv.PublisherID},
+			{"DeveloperID", sqlite.TableDeveloper, tv.DeveloperID},
+			{"GenreID", sqlite.TableGenre, tv.GenreID},
+			{"FranchiseID", sqlite.TableFranchise, tv.FranchiseID},
+			{"ExtensionID", sqlite.TableFileExtension, tv.ExtensionID},
+			{"UniqueTypeID", sqlite.TableUniqueType, tv.UniqueTypeID},
+		}
+		for _, ref := range refs {
+			ids, ok := metaIDs[ref.table]
+			if ref.id != 0 && ok && !ids[ref.id] {
+				problem("%v: TitleVariant %v has unknown %v %v", ref.table, tv.ID, ref.column, ref.id)
+			}
+		}
+	}
+
+	// Stored parents are one level deep and on the same system
+	tvByID := make(map[int]ztdb.TitleVariant, len(tvs))
+	for _, tv := range tvs {
+		tvByID[tv.ID] = tv
+	}
+	for _, tv := range tvs {
+		if tv.ParentVariantID == 0 {
+			continue
+		}
+		parent, ok := tvByID[tv.ParentVariantID]
+		switch {
+		case !ok:
+			problem("%v: TitleVariant %v has unknown ParentVariantID %v", sqlite.TableTitleVariant, tv.ID, tv.ParentVariantID)
+		case parent.ID == tv.ID:
+			problem("%v: TitleVariant %v is its own parent", sqlite.TableTitleVariant, tv.ID)
+		case parent.SystemID != tv.SystemID:
+			problem("%v: TitleVariant %v has parent %v on another system", sqlite.TableTitleVariant, tv.ID, parent.ID)
+		case parent.ParentVariantID != 0:
+			problem("%v: TitleVariant %v has parent %v which is a clone of %v", sqlite.TableTitleVariant, tv.ID, parent.ID, parent.ParentVariantID)
+		}
+	}
+
+	tracks, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantTrack, make([]ztdb.TitleVariantTrack, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantTrack, err)
+		return
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].ID < tracks[j].ID
+	})
+	trackIDs := make(map[int]bool, len(tracks))
+	for _, t := range tracks {
+		if trackIDs[t.ID] {
+			problem("%v: duplicate ID %v", sqlite.TableTitleVariantTrack, t.ID)
+		}
+		trackIDs[t.ID] = true
+		if !tvIDs[t.TitleVariantID] {
+			problem("%v: track %v has unknown TitleVariantID %v", sqlite.TableTitleVariantTrack, t.ID, t.TitleVariantID)
+		}
+	}
+
+	tvls, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantLanguage, make([]ztdb.TitleVariantLanguage, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantLanguage, err)
+		return
+	}
+	sort.SliceStable(tvls, func(i, j int) bool {
+		if tvls[i].TitleVariantID != tvls[j].TitleVariantID {
+			return tvls[i].TitleVariantID < tvls[j].TitleVariantID
+		}
+		return tvls[i].LanguageID < tvls[j].LanguageID
+	})
+	for i, l := range tvls {
+		if i > 0 && tvls[i-1].TitleVariantID == l.TitleVariantID && tvls[i-1].LanguageID == l.LanguageID {
+			problem("%v: TitleVariant %v has LanguageID %v twice", sqlite.TableTitleVariantLanguage, l.TitleVariantID, l.LanguageID)
+		}
+		if !tvIDs[l.TitleVariantID] {
+			problem("%v: unknown TitleVariantID %v", sqlite.TableTitleVariantLanguage, l.TitleVariantID)
+		}
+		if ids, ok := metaIDs[sqlite.TableLanguage]; ok && !ids[l.LanguageID] {
+			problem("%v: TitleVariant %v has unknown LanguageID %v", sqlite.TableTitleVariantLanguage, l.TitleVariantID, l.LanguageID)
+		}
+	}
+
+	tvrs, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantRegion, make([]ztdb.TitleVariantRegion, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantRegion, err)
+		return
+	}
+	sort.SliceStable(tvrs, func(i, j int) bool {
+		if tvrs[i].TitleVariantID != tvrs[j].TitleVariantID {
+			return tvrs[i].TitleVariantID < tvrs[j].TitleVariantID
+		}
+		return tvrs[i].RegionID < tvrs[j].RegionID
+	})
+	for i, r := range tvrs {
+		if i > 0 && tvrs[i-1].TitleVariantID == r.TitleVariantID && tvrs[i-1].RegionID == r.RegionID {
+			problem("%v: TitleVariant %v has RegionID %v twice", sqlite.TableTitleVariantRegion, r.TitleVariantID, r.RegionID)
+		}
+		if !tvIDs[r.TitleVariantID] {
+			problem("%v: unknown TitleVariantID %v", sqlite.TableTitleVariantRegion, r.TitleVariantID)
+		}
+		if ids, ok := metaIDs[sqlite.TableRegion]; ok && !ids[r.RegionID] {
+			problem("%v: TitleVariant %v has unknown RegionID %v", sqlite.TableTitleVariantRegion, r.TitleVariantID, r.RegionID)
+		}
+	}
+
+	if len(problems) > 0 {
+		for i, p := range problems {
+			if i == maxBuildProblems {
+				fmt.Println("...")
+				break
+			}
+			fmt.Println(p)
+		}
+		fmt.Println(len(problems), "problems found, database not written")
+		return
+	}
+
+	inferred := ztdb.InferParentVariants(tvs)
+	fmt.Println("Inferred", inferred, "parent variants")
+	versions := ztdb.FillVersions(tvs)
+	fmt.Println("Parsed", versions, "variant versions")
+
+	info, err := sqlite.GetZTDBInfo(db)
+	if err != nil {
+		fmt.Println("Error reading ZTDBInfo", err)
+		return
+	}
+	info.Date = date
+	err = sqlite.SetZTDBInfo(db, info)
+	if err != nil {
+		fmt.Println("Error writing ZTDBInfo", err)
+		return
+	}
+
+	err = sqlite.BulkInsertSystems(db, systems)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableSystem, err)
+		return
+	}
+	err = sqlite.BulkInsertRegions(db, regions)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableRegion, err)
+		return
+	}
+	for _, table := range buildMetaTables {
+		err = sqlite.BulkInsertGenericMeta(db, table, metas[table])
+		if err != nil {
+			fmt.Println("Error BulkInserting into", table, err)
+			return
+		}
+	}
+	err = sqlite.BulkInsertTitles(db, titles)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableTitle, err)
+		return
+	}
+	err = sqlite.BulkInsertTitleVariants(db, tvs)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableTitleVariant, err)
+		return
+	}
+	err = sqlite.BulkInsertTitleVariantTracks(db, tracks)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableTitleVariantTrack, err)
+		return
+	}
+	err = sqlite.BulkInsertTitleVariantLanguages(db, tvls)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableTitleVariantLanguage, err)
+		return
+	}
+	err = sqlite.BulkInsertTitleVariantRegions(db, tvrs)
+	if err != nil {
+		fmt.Println("Error BulkInserting into", sqlite.TableTitleVariantRegion, err)
+		return
+	}
+
+	err = sqlite.CreateZTDBIndexes(db)
+	if err != nil {
+		fmt.Println("Error creating indexes", err)
+		return
+	}
+
+	if sqlite.FTS5Enabled {
+		err = sqlite.CreateSearchIndex(db)
+		if err != nil {
+			fmt.Println("Error creating search index", err)
+			return
+		}
+	} else {
+		fmt.Println("WARNING: search index skipped,", sqlite.ErrNoFTS5)
+	}
+
+	err = os.MkdirAll(filepath.Dir(settings.DBPath), 0755)
+	if err != nil {
+		fmt.Println("Cannot create sqlite dir", err)
+		return
+	}
+	err = sqlite.SaveZTDB(db, settings.DBPath)
+	if err != nil {
+		fmt.Println("Error writing", settings.DBPath, err)
+		return
+	}
+	fmt.Println("Saved", settings.DBPath, len(systems), "systems", len(titles), "titles", len(tvs), "title variants", len(tracks), "tracks", len(tvls), "variant languages", len(tvrs), "variant regions")
+	manifest()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/dat"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Writes one Logiqx DAT per system from the sqlite database so collections can
+be verified with RomVault/clrmamepro. Every variant is a game, its file and
+its TitleVariantTracks are the roms, so a Redump disc exports as its .cue and
+.bin tracks. Clones name their parent's game in cloneof.
+*/
+
+func exportdat() {
+	db, err := sqlite.OpenZTDB()
+	if err != nil {
+		fmt.Println("Error Opening DB", err)
+		return
+	}
+	defer db.Close()
+
+	info, err := sqlite.GetZTDBInfo(db)
+	if err != nil {
+		fmt.Println("Error Querying ZTDBInfo", err)
+		return
+	}
+	systems, err := sqlite.GetSystems(db)
+	if err != nil {
+		fmt.Println("Error Querying Systems", err)
+		return
+	}
+
+	err = os.MkdirAll(settings.DatBuildDir, 0755)
+	if err != nil {
+		fmt.Println("Cannot create DAT dir", settings.DatBuildDir, err)
+		return
+	}
+
+	for _, system := range systems {
+		tvs, err := sqlite.GetTitleVariantsBySystemID(db, system.ID)
+		if err != nil || len(tvs) == 0 {
+			continue
+		}
+
+		systemName := strings.TrimSuffix(system.Name, ".rdb")
+		df := dat.DatFile{
+			Header: dat.DatHeader{
+				Name:        systemName,
+				Description: fmt.Sprintf("%v (Zaparoo Titles Database %v)", systemName, info.Version),
+				Version:     info.Version,
+				Date:        info.Date,
+				Author:      "Zaparoo Titles Database",
+				Homepage:    "Zaparoo",
+				URL:         "https://github.com/ZaparooProject/zaparoo-titles-database",
+			},
+		}
+		df.Games, err = datGames(db, tvs)
+		if err != nil {
+			fmt.Println("Error querying tracks", systemName, err)
+			continue
+		}
+
+		datPath := filepath.Join(settings.DatBuildDir, systemName+".dat")
+		outfile, err := os.Create(datPath)
+		if err != nil {
+			fmt.Println("Cannot create DAT", datPath, err)
+			continue
+		}
+		err = dat.WriteLogiqx(outfile, df)
+		outfile.Close()
+		if err != nil {
+			fmt.Println("Error writing DAT", datPath, err)
+			continue
+		}
+		fmt.Println("Saved DAT", datPath, len(df.Games))
+	}
+	manifest()
+}
+
+// datGames makes a game of each variant. Variants that only differ by serial
+// share a file and are listed once. Game names must be unique, a variant
+// whose name is taken uses its filename, then its ID.
+func datGames(db *sql.DB, tvs []ztdb.TitleVariant) ([]dat.DatGame, error) {
+	games := make([]dat.DatGame, 0, len(tvs))
+	gameNames := make(map[int]string, len(tvs))
+	parents := make(map[int]int, len(tvs))
+	taken := make(map[string]bool, len(tvs))
+	files := make(map[string]int)
+	for _, tv := range tvs {
+		name := tv.Name
+		base := ztdb.GetFileFragments(tv.Filename).FileNameNoExt
+		if name == "" {
+			name = base
+		}
+		file := fmt.Sprintf("%v/%v/%v/%v/%v/%v", name, tv.Filename, tv.Size, tv.CRC, tv.MD5, tv.SHA1)
+		if id, ok := files[file]; ok && tv.Filename != "" {
+			gameNames[tv.ID] = gameNames[id]
+			continue
+		}
+		files[file] = tv.ID
+		description := tv.Description
+		if description == "" {
+			description = name
+		}
+		if taken[name] && base != "" && !taken[base] {
+			name = base
+		} else if taken[name] || name == "" {
+			name = fmt.Sprintf("%v (%v)", name, tv.ID)
+		}
+		taken[name] = true
+		gameNames[tv.ID] = name
+		parents[len(games)] = tv.ParentVariantID
+
+		roms := make([]dat.DatRom, 0, 1)
+		if tv.Filename != "" {
+			roms = append(roms, dat.DatRom{
+				Name:   tv.Filename,
+				Size:   tv.Size,
+				CRC:    strings.ToLower(tv.CRC),
+				MD5:    strings.ToLower(tv.MD5),
+				SHA1:   strings.ToLower(tv.SHA1),
+				Serial: rdb.DecodeSerial(tv.Serial),
+			})
+		}
+		tracks, err := sqlite.GetTitleVariantTracks(db, tv.ID)
+		if err != nil {
+			return games, err
+		}
+		for _, track := range tracks {
+			roms = append(roms, dat.DatRom{
+				Name: track.Filename,
+				Size: track.Size,
+				CRC:  strings.ToLower(track.CRC),
+				MD5:  strings.ToLower(track.MD5),
+				SHA1: strings.ToLower(track.SHA1),
+			})
+		}
+		games = append(games, dat.DatGame{
+			Name:        name,
+			Description: description,
+			Roms:        roms,
+		})
+	}
+	for i, parentID := range parents {
+		if parentID != 0 && gameNames[parentID] != games[i].Name {
+			games[i].CloneOf = gameNames[parentID]
+		}
+	}
+	return games, nil
+}
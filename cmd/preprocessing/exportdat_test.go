@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/dat"
+)
+
+// multiTrackDAT is a Redump DAT with a disc and its cue sheet and a clone
+// whose DAT has no sheet, only tracks
+const multiTrackDAT = `<?xml version="1.0"?>
+<datafile>
+	<header>
+		<name>Sony - PlayStation</name>
+		<description>Sony - PlayStation</description>
+	</header>
+	<game name="Zzyzx Racer (USA)">
+		<description>Zzyzx Racer (USA)</description>
+		<rom name="Zzyzx Racer (USA).cue" size="300" crc="11111111" md5="11111111111111111111111111111111" sha1="1111111111111111111111111111111111111111"/>
+		<rom name="Zzyzx Racer (USA) (Track 1).bin" size="1000" crc="22222222" md5="22222222222222222222222222222222" sha1="2222222222222222222222222222222222222222"/>
+		<rom name="Zzyzx Racer (USA) (Track 2).bin" size="2000" crc="33333333" md5="33333333333333333333333333333333" sha1="3333333333333333333333333333333333333333"/>
+	</game>
+	<game name="Zzyzx Racer (Europe)" cloneof="Zzyzx Racer (USA)">
+		<description>Zzyzx Racer (Europe)</description>
+		<rom name="Zzyzx Racer (Europe) (Track 1).bin" size="1000" crc="44444444" md5="44444444444444444444444444444444" sha1="4444444444444444444444444444444444444444"/>
+		<rom name="Zzyzx Racer (Europe) (Track 2).bin" size="2000" crc="55555555" md5="55555555555555555555555555555555" sha1="5555555555555555555555555555555555555555"/>
+	</game>
+</datafile>
+`
+
+// testDB holds the lookup tables importdat and build need for one system
+var testDB = map[string]string{
+	"_Systems.ndjson": `{"id":121,"name":"Sony - PlayStation.rdb","zaparoo_id":"PSX","description":""}` + "\n",
+	"_Regions.ndjson": `{"id":37,"name":"Europe","description":"","parent_region_id":145,"aliases":["EU","europe"]}
+{"id":116,"name":"USA","description":"","iso_code":"US","parent_region_id":145,"aliases":["US","usa"]}
+{"id":145,"name":"World","description":"","aliases":["world"]}
+`,
+	"_Languages.ndjson":      `{"id":9,"name":"en","description":""}` + "\n",
+	"_FileExtensions.ndjson": "",
+	"_Titles.ndjson":         "",
+	"_Works.ndjson":          "",
+}
+
+// chdirTemp runs the test in an empty tree with db/ and assets/ directories,
+// settings paths are relative to the working directory
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for _, sub := range []string{"db", "assets/dat", "assets/sqlite"} {
+		err = os.MkdirAll(sub, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExportDATRoundTrip(t *testing.T) {
+	chdirTemp(t)
+	for name, data := range testDB {
+		err := os.WriteFile(filepath.Join("db", name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	datPath := filepath.Join("assets", "dat", "Sony - PlayStation.dat")
+	err := os.WriteFile(datPath, []byte(multiTrackDAT), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importdat()
+	build("", true)
+	exportdat()
+
+	want, err := dat.LoadDAT(datPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := dat.LoadDAT(filepath.Join("assets", "datbuild", "Sony - PlayStation.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Games, want.Games) {
+		t.Errorf("exported games\n got  %+v\n want %+v", got.Games, want.Games)
+	}
+}
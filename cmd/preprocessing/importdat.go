@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/dat"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Merges No-Intro/Redump DATs from assets/dat into the per system NDJSON.
+DATs are matched to a system by header name, falling back to the filename
+without the date suffix, e.g. "Nintendo - Game Boy (20250601-000000).dat".
+A game's cloneof becomes the parent_variant_id of its first rom, pointing at
+the first rom of the root parent game. Parents are only filled in when unset.
+A Redump disc is one variant, its .cue or .gdi, and its "(Track 02)" files are
+stored as TitleVariantTracks of that variant only. New variants join the title
+maketitles would give them, by TitleOverrides name or the title of the same
+name, creating it when there is none. makeregions and makelanguages then run
+for the new variants, and makeworks for the new titles, so the result builds
+without further commands.
+*/
+
+func importdat() {
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+	systemsByName := make(map[string]ztdb.System, len(systems))
+	for _, system := range systems {
+		systemsByName[system.Name] = system
+	}
+
+	datPaths, err := filepath.Glob(filepath.Join(settings.DatDir, "*.dat"))
+	if err != nil {
+		fmt.Println("Unable to list DATs", settings.DatDir, err)
+		return
+	}
+	xmlPaths, _ := filepath.Glob(filepath.Join(settings.DatDir, "*.xml"))
+	datPaths = append(datPaths, xmlPaths...)
+
+	romsBySystem := make(map[string][]rdb.RdbJsonROM)
+	for _, datPath := range datPaths {
+		df, err := dat.LoadDAT(datPath)
+		if err != nil {
+			fmt.Println("Unable to parse DAT", datPath, err)
+			continue
+		}
+		systemName := df.Header.Name + ".rdb"
+		if _, ok := systemsByName[systemName]; !ok {
+			base := strings.TrimSuffix(filepath.Base(datPath), filepath.Ext(datPath))
+			systemName = strings.TrimSpace(ztdb.GetTitleFromName(base)) + ".rdb"
+		}
+		if _, ok := systemsByName[systemName]; !ok {
+			fmt.Println("No system found for DAT, skipping", datPath, df.Header.Name)
+			continue
+		}
+		fmt.Println("Loaded DAT", datPath, "for", systemName, len(df.Games), "games")
+		romsBySystem[systemName] = append(romsBySystem[systemName], df.ROMs(systemName)...)
+	}
+	if len(romsBySystem) == 0 {
+		fmt.Println("No DATs to import in", settings.DatDir)
+		return
+	}
+
+	titles, err := ztdb.LoadNDJSON(sqlite.TableTitle, make([]ztdb.Title, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitle, err)
+		return
+	}
+	overrides, err := ztdb.LoadNDJSON(TitleOverridesNDJSON, make([]ztdb.TitleOverride, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", TitleOverridesNDJSON, err)
+		return
+	}
+	titleByName := make(map[string]int, len(titles))
+	maxTitleID := 0
+	for _, t := range titles {
+		if id, ok := titleByName[t.Name]; !ok || t.ID < id {
+			titleByName[t.Name] = t.ID
+		}
+		maxTitleID = max(maxTitleID, t.ID)
+	}
+	overrideByName := make(map[string]int)
+	for _, o := range overrides {
+		if o.TitleVariantID == 0 && o.Name != "" {
+			overrideByName[o.Name] = o.TitleID
+		}
+	}
+
+	// TitleVariant IDs are unique across all systems
+	nextID := 1
+	for _, system := range systems {
+		tvs, _ := ztdb.LoadSystemNDJSON(system.Name)
+		for _, tv := range tvs {
+			if tv.ID >= nextID {
+				nextID = tv.ID + 1
+			}
+			maxTitleID = max(maxTitleID, tv.TitleID)
+		}
+	}
+	// Variants without a derived title get title 0, as in maketitles
+	titlesCreated, variantsAdded := 0, 0
+	titleFor := func(tv ztdb.TitleVariant) int {
+		name := ztdb.GetTitleFromVariant(tv)
+		if id, ok := overrideByName[name]; ok {
+			return id
+		} else if name == "" {
+			return 0
+		}
+		if id, ok := titleByName[name]; ok {
+			return id
+		}
+		maxTitleID++
+		titles = append(titles, ztdb.Title{ID: maxTitleID, Name: name})
+		titleByName[name] = maxTitleID
+		titlesCreated++
+		return maxTitleID
+	}
+
+	exts, err := ztdb.LoadNDJSON(sqlite.TableFileExtension, make([]ztdb.GenericDBMeta, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableFileExtension, err)
+		return
+	}
+	extIDs := make(map[string]int, len(exts))
+	nextExtID := 1
+	for _, ext := range exts {
+		extIDs[ext.Name] = ext.ID
+		if ext.ID >= nextExtID {
+			nextExtID = ext.ID + 1
+		}
+	}
+	regionIDs := loadRegionTagIDs()
+
+	tracks, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantTrack, make([]ztdb.TitleVariantTrack, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantTrack, err)
+		return
+	}
+	trackIndex := make(map[string]int, len(tracks))
+	nextTrackID := 1
+	for i, t := range tracks {
+		trackIndex[fmt.Sprintf("%v:%v", t.TitleVariantID, t.Number)] = i
+		if t.ID >= nextTrackID {
+			nextTrackID = t.ID + 1
+		}
+	}
+
+	systemNames := make([]string, 0, len(romsBySystem))
+	for systemName := range romsBySystem {
+		systemNames = append(systemNames, systemName)
+	}
+	sort.Strings(systemNames)
+
+	for _, systemName := range systemNames {
+		system := systemsByName[systemName]
+		tvs, err := ztdb.LoadSystemNDJSON(systemName)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println("Unable to load ndjson", systemName, err)
+			continue
+		}
+
+		bySHA1 := make(map[string]int)
+		byMD5 := make(map[string]int)
+		byCRC := make(map[string]int)
+		byFilename := make(map[string]int)
+		// discs imported without a sheet have no file, only a name
+		byDiscName := make(map[string]int)
+		index := func(i int) {
+			tv := tvs[i]
+			if tv.SHA1 != "" {
+				bySHA1[tv.SHA1] = i
+			}
+			if tv.MD5 != "" {
+				byMD5[tv.MD5] = i
+			}
+			if tv.CRC != "" {
+				byCRC[fmt.Sprintf("%v:%v", tv.CRC, tv.Size)] = i
+			}
+			if tv.Filename != "" {
+				byFilename[tv.Filename] = i
+			} else if tv.Name != "" {
+				byDiscName[tv.Name] = i
+			}
+		}
+		for i := range tvs {
+			index(i)
+		}
+
+		added, updated := 0, 0
+		// DAT roms are grouped by game name, in DAT order. Track files are
+		// only kept as tracks of their disc, never as variants.
+		discs := make(map[string][]discTrack)
+		discNames := make([]string, 0)
+		addTrack := func(rom rdb.RdbJsonROM) bool {
+			number, ok := trackNumber(rom.RomName)
+			if !ok {
+				return false
+			}
+			if _, ok := discs[rom.Name]; !ok {
+				discNames = append(discNames, rom.Name)
+			}
+			discs[rom.Name] = append(discs[rom.Name], discTrack{rom, number})
+			return true
+		}
+		// first variant of every game and the game it is a clone of
+		gameVariants := make(map[string]int)
+		gameParents := make(map[string]string)
+		addGame := func(rom rdb.RdbJsonROM, variantID int) {
+			if _, ok := gameVariants[rom.Name]; ok {
+				return
+			}
+			gameVariants[rom.Name] = variantID
+			if rom.CloneOf != "" {
+				gameParents[rom.Name] = rom.CloneOf
+			}
+		}
+		addVariant := func(rom rdb.RdbJsonROM) {
+			frag := ztdb.GetFileFragments(rom.RomName)
+			tv := ztdb.TitleVariant{
+				ID:          nextID,
+				SystemID:    system.ID,
+				Filename:    rom.RomName,
+				RegionID:    regionIDFromTags(regionIDs, rom.Name),
+				Serial:      rom.Serial,
+				MD5:         rom.MD5,
+				SHA1:        rom.SHA1,
+				CRC:         rom.CRC,
+				Size:        rom.Size,
+				Name:        rom.Name,
+				Description: rom.Description,
+			}
+			nextID++
+			tv.CompactNames()
+			if frag.Ext != "" {
+				if _, ok := extIDs[frag.Ext]; !ok {
+					extIDs[frag.Ext] = nextExtID
+					exts = append(exts, ztdb.GenericDBMeta{ID: nextExtID, Name: frag.Ext})
+					nextExtID++
+				}
+				tv.ExtensionID = extIDs[frag.Ext]
+			}
+			tv.TitleID = titleFor(tv)
+			tvs = append(tvs, tv)
+			index(len(tvs) - 1)
+			added++
+			addGame(rom, tv.ID)
+		}
+		for _, rom := range romsBySystem[systemName] {
+			if addTrack(rom) {
+				continue
+			}
+			// Same priority as indexunique, empty keys are never indexed
+			i, ok := bySHA1[rom.SHA1]
+			if !ok {
+				i, ok = byMD5[rom.MD5]
+			}
+			if !ok {
+				i, ok = byCRC[fmt.Sprintf("%v:%v", rom.CRC, rom.Size)]
+			}
+			if !ok {
+				i, ok = byFilename[rom.RomName]
+			}
+
+			if ok {
+				// Only fill in what's missing, existing data may be hand edited
+				tv := &tvs[i]
+				changed := false
+				fill := func(dst *string, src string) {
+					if *dst == "" && src != "" {
+						*dst = src
+						changed = true
+					}
+				}
+				fill(&tv.SHA1, rom.SHA1)
+				fill(&tv.MD5, rom.MD5)
+				fill(&tv.CRC, rom.CRC)
+				fill(&tv.Serial, rom.Serial)
+				if tv.Size == 0 && rom.Size != 0 {
+					tv.Size = rom.Size
+					changed = true
+				}
+				if tv.TitleID == 0 {
+					if id := titleFor(*tv); id != 0 {
+						tv.TitleID = id
+						changed = true
+					}
+				}
+				if changed {
+					updated++
+					index(i)
+				}
+				addGame(rom, tv.ID)
+				continue
+			}
+			addVariant(rom)
+		}
+		// The disc is the variant of its .cue or .gdi, a disc without a
+		// sheet in the DAT gets a variant named after the game
+		for _, name := range discNames {
+			if _, ok := gameVariants[name]; ok {
+				continue
+			}
+			first := discs[name][0].rom
+			disc := rdb.RdbJsonROM{
+				Serial:      first.Serial,
+				Name:        name,
+				Description: first.Description,
+				CloneOf:     first.CloneOf,
+			}
+			if i, ok := byDiscName[name]; ok {
+				addGame(disc, tvs[i].ID)
+				continue
+			}
+			addVariant(disc)
+		}
+
+		clones := 0
+		byID := make(map[int]int, len(tvs))
+		for i, tv := range tvs {
+			byID[tv.ID] = i
+		}
+		for game := range gameParents {
+			tv := &tvs[byID[gameVariants[game]]]
+			parentID, ok := gameVariants[rootGame(gameParents, game)]
+			if !ok || tv.ParentVariantID != 0 || parentID == tv.ID {
+				continue
+			}
+			// the parent may have been made a clone by hand
+			if p := tvs[byID[parentID]].ParentVariantID; p != 0 {
+				parentID = p
+			}
+			if parentID == tv.ID {
+				continue
+			}
+			tv.ParentVariantID = parentID
+			clones++
+		}
+
+		discCount := 0
+		for _, name := range discNames {
+			discTracks := discs[name]
+			discCount++
+			sort.SliceStable(discTracks, func(i, j int) bool {
+				return discTracks[i].number < discTracks[j].number
+			})
+			discID := gameVariants[name]
+			for _, dt := range discTracks {
+				t := ztdb.TitleVariantTrack{
+					TitleVariantID: discID,
+					Number:         dt.number,
+					Filename:       dt.rom.RomName,
+					MD5:            dt.rom.MD5,
+					SHA1:           dt.rom.SHA1,
+					CRC:            dt.rom.CRC,
+					Size:           dt.rom.Size,
+				}
+				key := fmt.Sprintf("%v:%v", t.TitleVariantID, t.Number)
+				if i, ok := trackIndex[key]; ok {
+					t.ID = tracks[i].ID
+					tracks[i] = t
+					continue
+				}
+				t.ID = nextTrackID
+				nextTrackID++
+				tracks = append(tracks, t)
+				trackIndex[key] = len(tracks) - 1
+			}
+		}
+
+		sort.SliceStable(tvs, func(i, j int) bool {
+			return tvs[i].ID < tvs[j].ID
+		})
+		err = ztdb.SaveSystemNDJSON(systemName, tvs)
+		if err != nil {
+			fmt.Println("Error writing NDJSON", systemName, err)
+			continue
+		}
+		variantsAdded += added
+		fmt.Println("Imported", systemName, "added", added, "updated", updated, "multi track discs", discCount, "clones", clones)
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].ID < tracks[j].ID
+	})
+	err = ztdb.SaveNDJSON(sqlite.TableTitleVariantTrack, tracks)
+	if err != nil {
+		fmt.Println("Error writing NDJSON", sqlite.TableTitleVariantTrack, err)
+	}
+
+	err = ztdb.SaveNDJSON(sqlite.TableFileExtension, exts)
+	if err != nil {
+		fmt.Println("Error writing NDJSON", sqlite.TableFileExtension, err)
+	}
+
+	if titlesCreated > 0 {
+		sort.SliceStable(titles, func(i, j int) bool {
+			return titles[i].ID < titles[j].ID
+		})
+		err = ztdb.SaveNDJSON(sqlite.TableTitle, titles)
+		if err != nil {
+			fmt.Println("Error writing NDJSON", sqlite.TableTitle, err)
+		}
+		fmt.Println("Created", titlesCreated, "titles")
+		makeworks()
+	}
+	if variantsAdded > 0 {
+		makeregions()
+		makelanguages()
+	}
+}
+
+// loadRegionTagIDs maps lowercase region names, ISO codes and aliases to IDs
+func loadRegionTagIDs() map[string]int {
+	regionIDs := make(map[string]int)
+	regions, err := ztdb.LoadNDJSON(sqlite.TableRegion, make([]ztdb.Region, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableRegion, err)
+		return regionIDs
+	}
+	for _, region := range regions {
+		for _, name := range region.Names() {
+			regionIDs[name] = region.ID
+		}
+	}
+	return regionIDs
+}
+
+// regionIDFromTags is the first region tagged in a name, No-Intro names and
+// TOSEC codes resolve through the region aliases
+func regionIDFromTags(regionIDs map[string]int, name string) int {
+	for _, region := range ztdb.ParseFileTags(name).Regions {
+		if id, ok := regionIDs[strings.ToLower(region)]; ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// rootGame follows cloneof to the top parent, DATs should only go one level
+// deep but some chain clones and a few loop
+func rootGame(parents map[string]string, game string) string {
+	seen := map[string]bool{game: true}
+	for {
+		parent, ok := parents[game]
+		if !ok || seen[parent] {
+			return game
+		}
+		seen[parent] = true
+		game = parent
+	}
+}
+
+var trackNumberTag = regexp.MustCompile(`\(Track (\d+)`)
+
+type discTrack struct {
+	rom    rdb.RdbJsonROM
+	number int
+}
+
+// trackNumber reads the "(Track 02)" tag Redump gives each file of a multi
+// track disc, sheets and single track dumps have none
+func trackNumber(romName string) (int, bool) {
+	m := trackNumberTag.FindStringSubmatch(romName)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil
+}
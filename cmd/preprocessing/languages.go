@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Regenerates _TitleVariantLanguages.ndjson from the language tags of every
+variant, ztdb.GetVariantLanguages. Variants without a language tag get the
+languages their regions imply, marked implied. Variants the tags say nothing
+about keep the languages already stored for them, so languages can be added
+by hand for those. Language codes missing from _Languages.ndjson are added.
+*/
+
+func makelanguages() {
+	languages, err := ztdb.LoadNDJSON(sqlite.TableLanguage, make([]ztdb.GenericDBMeta, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableLanguage, err)
+		return
+	}
+	existing, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantLanguage, make([]ztdb.TitleVariantLanguage, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantLanguage, err)
+		return
+	}
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+	regions := loadMetaNames(sqlite.TableRegion)
+
+	languageIDs := make(map[string]int, len(languages))
+	nextLanguageID := 1
+	for _, l := range languages {
+		languageIDs[l.Name] = l.ID
+		nextLanguageID = max(nextLanguageID, l.ID+1)
+	}
+	kept := make(map[int][]ztdb.TitleVariantLanguage)
+	for _, l := range existing {
+		kept[l.TitleVariantID] = append(kept[l.TitleVariantID], l)
+	}
+
+	tvls := make([]ztdb.TitleVariantLanguage, 0, len(existing))
+	added, implied, keptCount := 0, 0, 0
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		for _, tv := range tvs {
+			codes, isImplied := ztdb.GetVariantLanguages(tv, regions[tv.RegionID])
+			if len(codes) == 0 {
+				tvls = append(tvls, kept[tv.ID]...)
+				keptCount += len(kept[tv.ID])
+				continue
+			}
+			seen := make(map[int]bool, len(codes))
+			for _, code := range codes {
+				id, ok := languageIDs[code]
+				if !ok {
+					id = nextLanguageID
+					nextLanguageID++
+					languageIDs[code] = id
+					languages = append(languages, ztdb.GenericDBMeta{ID: id, Name: code})
+					added++
+				}
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				tvls = append(tvls, ztdb.TitleVariantLanguage{TitleVariantID: tv.ID, LanguageID: id, Implied: isImplied})
+				if isImplied {
+					implied++
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(tvls, func(i, j int) bool {
+		if tvls[i].TitleVariantID != tvls[j].TitleVariantID {
+			return tvls[i].TitleVariantID < tvls[j].TitleVariantID
+		}
+		return tvls[i].LanguageID < tvls[j].LanguageID
+	})
+	err = ztdb.SaveNDJSON(sqlite.TableTitleVariantLanguage, tvls)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableTitleVariantLanguage, err)
+		return
+	}
+	if added > 0 {
+		err = ztdb.SaveNDJSON(sqlite.TableLanguage, languages)
+		if err != nil {
+			fmt.Println("Unable to save ndjson", sqlite.TableLanguage, err)
+			return
+		}
+	}
+	fmt.Println(len(tvls), "variant languages,", implied, "implied,", keptCount, "kept,", added, "languages added")
+}
@@ -24,10 +24,23 @@ const (
 	CMDindexunique          string = "indexunique"
 	CMDmakeztdbjsonmeta     string = "makeztdbjsonmeta"
 	CMDmakeztdbjsonvariants string = "makeztdbjsonvariants"
+	CMDmakerdb              string = "makerdb"
+	CMDimportdat            string = "importdat"
+	CMDexportdat            string = "exportdat"
+	CMDbuild                string = "build"
+	CMDmanifest             string = "manifest"
+	CMDmapsystems           string = "mapsystems"
+	CMDmaketitles           string = "maketitles"
+	CMDmakeworks            string = "makeworks"
+	CMDmakelanguages        string = "makelanguages"
+	CMDmigrateregions       string = "migrateregions"
+	CMDmakeregions          string = "makeregions"
 )
 
 func main() {
-	cmdPtr := flag.String("cmd", "", "[fetchrdbs, makendjson, indexunique, makeztdbjsonmeta, makeztdbjson]")
+	cmdPtr := flag.String("cmd", "", "[fetchrdbs, makendjson, indexunique, makeztdbjsonmeta, makeztdbjson, makerdb, importdat, exportdat, build, manifest, mapsystems, maketitles, makeworks, makelanguages, migrateregions, makeregions]")
+	datePtr := flag.String("date", "", "build date stored in ZTDBInfo, leave empty for reproducible builds")
+	noSearchPtr := flag.Bool("nosearch", false, "build without the search index when sqlite isn't built with FTS5")
 	flag.Parse()
 
 	switch *cmdPtr {
@@ -41,6 +54,28 @@ func main() {
 		makeztdbjsonmeta()
 	case CMDmakeztdbjsonvariants:
 		makeztdbjsonvariants()
+	case CMDmakerdb:
+		makerdb()
+	case CMDimportdat:
+		importdat()
+	case CMDexportdat:
+		exportdat()
+	case CMDbuild:
+		build(*datePtr, *noSearchPtr)
+	case CMDmanifest:
+		manifest()
+	case CMDmapsystems:
+		mapsystems()
+	case CMDmaketitles:
+		maketitles()
+	case CMDmakeworks:
+		makeworks()
+	case CMDmakelanguages:
+		makelanguages()
+	case CMDmigrateregions:
+		migrateregions()
+	case CMDmakeregions:
+		makeregions()
 	default:
 		fmt.Println("no cmd to run")
 	}
@@ -54,7 +89,10 @@ func fetchrdbs() {
 
 func makendjson() {
 	for _, name := range rdb.RBDNames {
-		rdb.MakeNDJSON(name)
+		err := rdb.MakeNDJSON(name)
+		if err != nil {
+			fmt.Println("Error making NDJSON", name, err)
+		}
 	}
 }
 
@@ -404,12 +442,7 @@ func makeztdbjsonvariants() {
 		}
 
 		// Clear redundant names/descriptions for storage
-		if tv.Name == tv.Filename || tv.Name == frag.FileNameNoExt {
-			tv.Name = ""
-		}
-		if tv.Description == tv.Filename || tv.Description == frag.FileNameNoExt || tv.Description == tv.Name {
-			tv.Description = ""
-		}
+		tv.CompactNames()
 
 		if title != "" {
 			table := sqlite.TableTitle
@@ -504,6 +537,10 @@ func makeztdbjsonvariants() {
 		}
 	}
 	db.Exec(`Commit`)
+	err = sqlite.CreateZTDBIndexes(db)
+	if err != nil {
+		fmt.Println("Error creating indexes", err)
+	}
 	db.Exec("VACUUM INTO ?", settings.DBPath)
 
 	// Generate the NDJSONs by SYSTEM ID
@@ -535,3 +572,78 @@ func makeztdbjsonvariants() {
 	udb.Close()
 	db.Close()
 }
+
+func loadMetaNames(table string) map[int]string {
+	names := make(map[int]string, 0)
+	metas, err := ztdb.LoadNDJSON(table, make([]ztdb.GenericDBMeta, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", table, err)
+	}
+	for _, meta := range metas {
+		names[meta.ID] = meta.Name
+	}
+	return names
+}
+
+func makerdb() {
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+	regions := loadMetaNames(sqlite.TableRegion)
+	publishers := loadMetaNames(sqlite.TablePublisher)
+	developers := loadMetaNames(sqlite.TableDeveloper)
+	genres := loadMetaNames(sqlite.TableGenre)
+	franchises := loadMetaNames(sqlite.TableFranchise)
+
+	err = os.MkdirAll(settings.RdbBuildDir, 0755)
+	if err != nil {
+		fmt.Println("Cannot create RDB dir", settings.RdbBuildDir, err)
+		return
+	}
+
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if err != nil || len(tvs) == 0 {
+			fmt.Println("No TitleVariants for system", system.Name, err)
+			continue
+		}
+
+		roms := make([]rdb.RdbJsonROM, 0, len(tvs))
+		for _, tv := range tvs {
+			// Names and descriptions are cleared when redundant, restore them
+			name, description := tv.FullNames()
+			roms = append(roms, rdb.RdbJsonROM{
+				Serial:       tv.Serial,
+				MD5:          tv.MD5,
+				SHA1:         tv.SHA1,
+				CRC:          tv.CRC,
+				Size:         tv.Size,
+				RomName:      tv.Filename,
+				Region:       regions[tv.RegionID],
+				Description:  description,
+				Name:         name,
+				Publisher:    publishers[tv.PublisherID],
+				Developer:    developers[tv.DeveloperID],
+				ReleaseYear:  tv.ReleaseYear,
+				ReleaseMonth: tv.ReleaseMonth,
+				Users:        tv.Users,
+				Genre:        genres[tv.GenreID],
+				Franchise:    franchises[tv.FranchiseID],
+			})
+		}
+
+		rdbPath := filepath.Join(settings.RdbBuildDir, system.Name)
+		warnings, err := rdb.WriteRDB(rdbPath, roms, rdb.RdbIndexFields)
+		if err != nil {
+			fmt.Println("Error writing RDB", rdbPath, err)
+			continue
+		}
+		for _, warning := range warnings {
+			fmt.Println(system.Name, warning)
+		}
+		fmt.Println("Saved RDB", rdbPath, len(roms))
+	}
+	manifest()
+}
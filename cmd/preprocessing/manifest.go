@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
+)
+
+/*
+Lists the SHA-256 of every published artifact in sha256sum format, paths are
+relative to the manifest so it can be checked with `sha256sum -c SHA256SUMS`
+from the assets directory.
+*/
+
+func manifest() {
+	paths := []string{settings.DBPath}
+	for _, dir := range []string{settings.RdbBuildDir, settings.DatBuildDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	base := filepath.Dir(settings.ManifestPath)
+	lines := make([]string, 0, len(paths))
+	for _, path := range paths {
+		sum, err := sha256File(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to hash", path, err)
+			return
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			rel = path
+		}
+		lines = append(lines, fmt.Sprintf("%v  %v\n", sum, filepath.ToSlash(rel)))
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i][66:] < lines[j][66:]
+	})
+
+	err := os.WriteFile(settings.ManifestPath, []byte(strings.Join(lines, "")), 0644)
+	if err != nil {
+		fmt.Println("Error writing", settings.ManifestPath, err)
+		return
+	}
+	fmt.Println("Saved", settings.ManifestPath, len(lines), "artifacts")
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Copies the curated rdb.ZaparooSystemIDs mapping into the zaparoo_id of
+_Systems.ndjson, systems in rdb.ZaparooUnsupported get an empty zaparoo_id.
+Edit the mapping, not the NDJSON, the build fails when the two disagree.
+*/
+
+func mapsystems() {
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+
+	changed := 0
+	for i, system := range systems {
+		zaparooID, ok := rdb.ZaparooSystemID(system.Name)
+		if !ok {
+			fmt.Println("No Zaparoo system mapping for", system.Name)
+			continue
+		}
+		if system.ZaparooSystemID != zaparooID {
+			systems[i].ZaparooSystemID = zaparooID
+			changed++
+		}
+	}
+
+	err = ztdb.SaveNDJSON(sqlite.TableSystem, systems)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableSystem, err)
+		return
+	}
+	fmt.Println("Updated", changed, "of", len(systems), "systems")
+}
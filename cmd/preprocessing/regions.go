@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Merges _Regions.ndjson into one row per region. makeztdbjsonmeta seeded
+No-Intro names ("usa", "europe") and TOSEC codes ("US", "EU") as unrelated rows
+next to the libretro names ("USA"), so one region was split across several
+IDs. Every row
+matching a canonicalRegions entry by name, ISO 3166 code or alias is merged
+into the row already named like the entry, or the lowest ID, which gets the
+entry's name, ISO code and parent. The names of merged rows are kept as
+aliases and region_id is rewritten in every system NDJSON. Running it again
+changes nothing, rows matching no entry are left alone.
+*/
+
+type canonicalRegion struct {
+	name    string
+	isoCode string
+	parent  string
+	aliases []string
+}
+
+// canonicalRegions are the regions No-Intro, Redump, TOSEC and libretro
+// name. Continents and countries without one are in World, the Nordic
+// countries are in Scandinavia and the Americas south of the USA in Latin
+// America. TOSEC uses AS and EU for Asia and Europe, CS and YU are withdrawn
+// ISO codes kept as aliases.
+var canonicalRegions = []canonicalRegion{
+	{"World", "", "", nil},
+	{"Europe", "", "World", []string{"EU"}},
+	{"Asia", "", "World", []string{"AS"}},
+	{"Scandinavia", "", "Europe", nil},
+	{"Latin America", "", "World", nil},
+	{"United Arab Emirates", "AE", "Asia", nil},
+	{"Argentina", "AR", "Latin America", nil},
+	{"Albania", "AL", "Europe", nil},
+	{"Austria", "AT", "Europe", nil},
+	{"Australia", "AU", "World", nil},
+	{"Bosnia and Herzegovina", "BA", "Europe", nil},
+	{"Belgium", "BE", "Europe", nil},
+	{"Bulgaria", "BG", "Europe", nil},
+	{"Brazil", "BR", "Latin America", nil},
+	{"Belarus", "BY", "Europe", nil},
+	{"Canada", "CA", "World", nil},
+	{"Switzerland", "CH", "Europe", nil},
+	{"Chile", "CL", "Latin America", nil},
+	{"China", "CN", "Asia", nil},
+	{"Serbia and Montenegro", "", "Europe", []string{"CS"}},
+	{"Cyprus", "CY", "Europe", nil},
+	{"Czech Republic", "CZ", "Europe", []string{"Czech"}},
+	{"Germany", "DE", "Europe", nil},
+	{"Denmark", "DK", "Scandinavia", nil},
+	{"Estonia", "EE", "Europe", nil},
+	{"Egypt", "EG", "World", nil},
+	{"Spain", "ES", "Europe", nil},
+	{"Finland", "FI", "Scandinavia", nil},
+	{"France", "FR", "Europe", nil},
+	{"United Kingdom", "GB", "Europe", []string{"UK"}},
+	{"Greece", "GR", "Europe", nil},
+	{"Hong Kong", "HK", "Asia", nil},
+	{"Croatia", "HR", "Europe", nil},
+	{"Hungary", "HU", "Europe", nil},
+	{"Indonesia", "ID", "Asia", nil},
+	{"Ireland", "IE", "Europe", nil},
+	{"Israel", "IL", "Asia", nil},
+	{"India", "IN", "Asia", nil},
+	{"Iran", "IR", "Asia", nil},
+	{"Iceland", "IS", "Europe", nil},
+	{"Italy", "IT", "Europe", nil},
+	{"Jordan", "JO", "Asia", nil},
+	{"Japan", "JP", "Asia", nil},
+	{"Korea", "KR", "Asia", nil},
+	{"Lithuania", "LT", "Europe", nil},
+	{"Luxembourg", "LU", "Europe", nil},
+	{"Latvia", "LV", "Europe", nil},
+	{"Mongolia", "MN", "Asia", nil},
+	{"Mexico", "MX", "Latin America", nil},
+	{"Malaysia", "MY", "Asia", nil},
+	{"Netherlands", "NL", "Europe", nil},
+	{"Norway", "NO", "Scandinavia", nil},
+	{"Nepal", "NP", "Asia", nil},
+	{"New Zealand", "NZ", "World", nil},
+	{"Oman", "OM", "Asia", nil},
+	{"Peru", "PE", "Latin America", nil},
+	{"Philippines", "PH", "Asia", nil},
+	{"Poland", "PL", "Europe", nil},
+	{"Portugal", "PT", "Europe", nil},
+	{"Qatar", "QA", "Asia", nil},
+	{"Romania", "RO", "Europe", nil},
+	{"Russia", "RU", "Europe", nil},
+	{"Sweden", "SE", "Scandinavia", nil},
+	{"Singapore", "SG", "Asia", nil},
+	{"Slovenia", "SI", "Europe", nil},
+	{"Slovakia", "SK", "Europe", nil},
+	{"Thailand", "TH", "Asia", nil},
+	{"Turkey", "TR", "Europe", nil},
+	{"Taiwan", "TW", "Asia", nil},
+	{"Ukraine", "UA", "Europe", nil},
+	{"USA", "US", "World", nil},
+	{"Vietnam", "VN", "Asia", nil},
+	{"Yugoslavia", "", "Europe", []string{"YU"}},
+	{"South Africa", "ZA", "World", nil},
+}
+
+func migrateregions() {
+	regions, err := ztdb.LoadNDJSON(sqlite.TableRegion, make([]ztdb.Region, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableRegion, err)
+		return
+	}
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+	merged, remap, added := mergeRegions(regions)
+
+	rewritten := 0
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		changed := 0
+		for i, tv := range tvs {
+			if id, ok := remap[tv.RegionID]; ok && id != tv.RegionID {
+				tvs[i].RegionID = id
+				changed++
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		err = ztdb.SaveSystemNDJSON(system.Name, tvs)
+		if err != nil {
+			fmt.Println("Unable to save ndjson", system.Name, err)
+			return
+		}
+		rewritten += changed
+	}
+
+	err = ztdb.SaveNDJSON(sqlite.TableRegion, merged)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableRegion, err)
+		return
+	}
+	fmt.Println(len(regions), "regions merged into", len(merged), "with", added, "added,", rewritten, "region IDs rewritten")
+}
+
+// mergeRegions merges the rows matching each canonicalRegions entry, see
+// migrateregions. remap maps the ID of every merged row to its region's ID,
+// added counts the entries no row matched.
+func mergeRegions(regions []ztdb.Region) (merged []ztdb.Region, remap map[int]int, added int) {
+	sort.SliceStable(regions, func(i, j int) bool {
+		return regions[i].ID < regions[j].ID
+	})
+
+	entries := make(map[string]int)
+	for i, c := range canonicalRegions {
+		names := append([]string{c.name, c.isoCode}, c.aliases...)
+		for _, name := range names {
+			if name != "" {
+				entries[strings.ToLower(name)] = i
+			}
+		}
+	}
+
+	// rows of each entry, the row already named like the entry first
+	rows := make(map[int][]int)
+	for i, region := range regions {
+		for _, name := range region.Names() {
+			if e, ok := entries[name]; ok {
+				if region.Name == canonicalRegions[e].name {
+					rows[e] = append([]int{i}, rows[e]...)
+				} else {
+					rows[e] = append(rows[e], i)
+				}
+				break
+			}
+		}
+	}
+
+	nextID := 1
+	for _, region := range regions {
+		nextID = max(nextID, region.ID+1)
+	}
+	canonicalIDs := make(map[int]int, len(canonicalRegions))
+	remap = make(map[int]int)
+	merged = make([]ztdb.Region, 0, len(regions))
+	kept := make(map[int]bool)
+	for e, c := range canonicalRegions {
+		region := ztdb.Region{ID: nextID}
+		if len(rows[e]) > 0 {
+			region = regions[rows[e][0]]
+		} else {
+			nextID++
+			added++
+		}
+		aliases := make(map[string]bool)
+		for _, i := range rows[e] {
+			kept[i] = true
+			remap[regions[i].ID] = region.ID
+			for _, name := range append([]string{regions[i].Name}, regions[i].Aliases...) {
+				aliases[name] = true
+			}
+		}
+		for _, alias := range c.aliases {
+			aliases[alias] = true
+		}
+		delete(aliases, c.name)
+		region.Name = c.name
+		region.ISOCode = c.isoCode
+		region.Aliases = make([]string, 0, len(aliases))
+		for alias := range aliases {
+			region.Aliases = append(region.Aliases, alias)
+		}
+		sort.Strings(region.Aliases)
+		if len(region.Aliases) == 0 {
+			region.Aliases = nil
+		}
+		canonicalIDs[e] = region.ID
+		merged = append(merged, region)
+	}
+	for i := range merged {
+		if parent := canonicalRegions[i].parent; parent != "" {
+			merged[i].ParentRegionID = canonicalIDs[entries[strings.ToLower(parent)]]
+		}
+	}
+	for i, region := range regions {
+		if !kept[i] {
+			fmt.Println("No canonical region for", region.ID, region.Name)
+			merged = append(merged, region)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].ID < merged[j].ID
+	})
+
+	return merged, remap, added
+}
+
+/*
+Regenerates _TitleVariantRegions.ndjson from the region tags of every variant
+and its RegionID, ztdb.GetVariantRegions, resolved by region name, ISO code or
+alias. Variants with neither keep the regions already stored for them. Tags
+naming no region are counted, add them to canonicalRegions and run
+migrateregions.
+*/
+
+func makeregions() {
+	regions, err := ztdb.LoadNDJSON(sqlite.TableRegion, make([]ztdb.Region, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableRegion, err)
+		return
+	}
+	existing, err := ztdb.LoadNDJSON(sqlite.TableTitleVariantRegion, make([]ztdb.TitleVariantRegion, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitleVariantRegion, err)
+		return
+	}
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+
+	regionIDs := make(map[string]int)
+	regionNames := make(map[int]string, len(regions))
+	for _, region := range regions {
+		regionNames[region.ID] = region.Name
+		for _, name := range region.Names() {
+			regionIDs[name] = region.ID
+		}
+	}
+	kept := make(map[int][]ztdb.TitleVariantRegion)
+	for _, r := range existing {
+		kept[r.TitleVariantID] = append(kept[r.TitleVariantID], r)
+	}
+
+	tvrs := make([]ztdb.TitleVariantRegion, 0, len(existing))
+	unknown := make(map[string]int)
+	multi, keptCount := 0, 0
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		for _, tv := range tvs {
+			seen := make(map[int]bool)
+			for _, name := range ztdb.GetVariantRegions(tv, regionNames[tv.RegionID]) {
+				// No-Intro's (Unknown) means the region isn't known
+				if name == "Unknown" {
+					continue
+				}
+				id, ok := regionIDs[strings.ToLower(name)]
+				if !ok {
+					unknown[name]++
+					continue
+				}
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				tvrs = append(tvrs, ztdb.TitleVariantRegion{TitleVariantID: tv.ID, RegionID: id})
+			}
+			if len(seen) == 0 {
+				tvrs = append(tvrs, kept[tv.ID]...)
+				keptCount += len(kept[tv.ID])
+			} else if len(seen) > 1 {
+				multi++
+			}
+		}
+	}
+
+	sort.SliceStable(tvrs, func(i, j int) bool {
+		if tvrs[i].TitleVariantID != tvrs[j].TitleVariantID {
+			return tvrs[i].TitleVariantID < tvrs[j].TitleVariantID
+		}
+		return tvrs[i].RegionID < tvrs[j].RegionID
+	})
+	err = ztdb.SaveNDJSON(sqlite.TableTitleVariantRegion, tvrs)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableTitleVariantRegion, err)
+		return
+	}
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println("Unknown region", name, unknown[name])
+	}
+	fmt.Println(len(tvrs), "variant regions,", multi, "variants in several,", keptCount, "kept,", len(unknown), "unknown region names")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+func TestMergeRegions(t *testing.T) {
+	// seeded rows: libretro names, No-Intro names, TOSEC codes and a region
+	// no entry knows
+	regions := []ztdb.Region{
+		{ID: 1, Name: "usa"},
+		{ID: 3, Name: "europe"},
+		{ID: 5, Name: "USA"},
+		{ID: 7, Name: "US", Aliases: []string{"United States"}},
+		{ID: 9, Name: "EU"},
+		{ID: 20, Name: "Atlantis"},
+	}
+	merged, remap, added := mergeRegions(regions)
+
+	wantRemap := map[int]int{1: 5, 5: 5, 7: 5, 3: 3, 9: 3}
+	if !reflect.DeepEqual(remap, wantRemap) {
+		t.Errorf("remap = %v, want %v", remap, wantRemap)
+	}
+	if added != len(canonicalRegions)-2 {
+		t.Errorf("added %v regions, want %v", added, len(canonicalRegions)-2)
+	}
+	if len(merged) != len(canonicalRegions)+1 {
+		t.Errorf("merged into %v regions, want %v", len(merged), len(canonicalRegions)+1)
+	}
+
+	byName := make(map[string]ztdb.Region)
+	for i, region := range merged {
+		if i > 0 && merged[i-1].ID >= region.ID {
+			t.Errorf("region %v after %v, want ID order", region.ID, merged[i-1].ID)
+		}
+		byName[region.Name] = region
+	}
+	world := byName["World"]
+	tests := []ztdb.Region{
+		// the row already named like the entry is kept, even with a higher ID
+		{ID: 5, Name: "USA", ISOCode: "US", ParentRegionID: world.ID, Aliases: []string{"US", "United States", "usa"}},
+		// otherwise the lowest ID is renamed
+		{ID: 3, Name: "Europe", ParentRegionID: world.ID, Aliases: []string{"EU", "europe"}},
+		{ID: 20, Name: "Atlantis"},
+	}
+	for _, want := range tests {
+		if got := byName[want.Name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("merged %+v, want %+v", got, want)
+		}
+	}
+	if world.ID <= 20 || world.ParentRegionID != 0 {
+		t.Errorf("added %+v, want a new ID without parent", world)
+	}
+	if germany := byName["Germany"]; germany.ParentRegionID != 3 {
+		t.Errorf("Germany is in %v, want Europe 3", germany.ParentRegionID)
+	}
+
+	// merging again changes nothing
+	again, remap, added := mergeRegions(merged)
+	if !reflect.DeepEqual(again, merged) || added != 0 {
+		t.Errorf("merging again added %v and changed the regions", added)
+	}
+	for from, to := range remap {
+		if from != to {
+			t.Errorf("merging again remaps %v to %v", from, to)
+		}
+	}
+}
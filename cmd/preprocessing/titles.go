@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Regenerates the title groups of every TitleVariant from ztdb.GetTitleFromVariant
+without renumbering anything:
+
+ 1. _TitleOverrides.ndjson pins a single variant, or every variant with a given
+    derived title, to a title ID. Overrides always win.
+ 2. Otherwise variants with the same derived title form a group. A group takes
+    the existing title of the same name, then the title ID most of its
+    variants already have, then a new ID above every ID in use.
+ 3. Titles keep their names once created, so a title can be renamed in
+    _Titles.ndjson without losing its variants. Unused titles are kept.
+
+Variants without a derived title, e.g. names starting with a tag, get title 0.
+Only the system NDJSON that changed is rewritten.
+*/
+
+const TitleOverridesNDJSON string = "TitleOverrides"
+
+func maketitles() {
+	titles, err := ztdb.LoadNDJSON(sqlite.TableTitle, make([]ztdb.Title, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitle, err)
+		return
+	}
+	overrides, err := ztdb.LoadNDJSON(TitleOverridesNDJSON, make([]ztdb.TitleOverride, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", TitleOverridesNDJSON, err)
+		return
+	}
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+
+	titleByID := make(map[int]ztdb.Title, len(titles))
+	titleByName := make(map[string]int, len(titles))
+	maxID := 0
+	for _, t := range titles {
+		titleByID[t.ID] = t
+		if id, ok := titleByName[t.Name]; !ok || t.ID < id {
+			titleByName[t.Name] = t.ID
+		}
+		maxID = max(maxID, t.ID)
+	}
+
+	overrideByVariant := make(map[int]int)
+	overrideByName := make(map[string]int)
+	for _, o := range overrides {
+		if _, ok := titleByID[o.TitleID]; !ok {
+			fmt.Println(TitleOverridesNDJSON, "references unknown title", o.TitleID, "create it in", sqlite.TableTitle, "first")
+			return
+		}
+		if o.TitleVariantID != 0 {
+			overrideByVariant[o.TitleVariantID] = o.TitleID
+		} else if o.Name != "" {
+			overrideByName[o.Name] = o.TitleID
+		}
+	}
+
+	type titleGroup struct {
+		variants []*ztdb.TitleVariant
+		// current title IDs and how many variants have them
+		current map[int]int
+	}
+	groups := make(map[string]*titleGroup)
+	systemTvs := make(map[string][]ztdb.TitleVariant)
+	before := make(map[string][]int)
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		systemTvs[system.Name] = tvs
+		ids := make([]int, len(tvs))
+		for i := range tvs {
+			tv := &tvs[i]
+			ids[i] = tv.TitleID
+			maxID = max(maxID, tv.TitleID)
+			title := ztdb.GetTitleFromVariant(*tv)
+			if id, ok := overrideByVariant[tv.ID]; ok {
+				tv.TitleID = id
+			} else if id, ok := overrideByName[title]; ok {
+				tv.TitleID = id
+			} else if title == "" {
+				tv.TitleID = 0
+			} else {
+				g, ok := groups[title]
+				if !ok {
+					g = &titleGroup{current: make(map[int]int)}
+					groups[title] = g
+				}
+				g.variants = append(g.variants, tv)
+				if tv.TitleID != 0 {
+					g.current[tv.TitleID]++
+				}
+			}
+		}
+		before[system.Name] = ids
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	current := make(map[string]map[int]int, len(groups))
+	for name, g := range groups {
+		current[name] = g.current
+	}
+	groupIDs, _ := assignGroupIDs(names, titleByName, current, maxID)
+
+	created := 0
+	used := make(map[int]bool)
+	for _, name := range names {
+		id := groupIDs[name]
+		used[id] = true
+		if _, ok := titleByID[id]; !ok {
+			titleByID[id] = ztdb.Title{ID: id, Name: name}
+			created++
+		}
+		for _, tv := range groups[name].variants {
+			tv.TitleID = id
+		}
+	}
+	for _, id := range overrideByVariant {
+		used[id] = true
+	}
+	for _, id := range overrideByName {
+		used[id] = true
+	}
+
+	titles = make([]ztdb.Title, 0, len(titleByID))
+	for _, t := range titleByID {
+		titles = append(titles, t)
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		return titles[i].ID < titles[j].ID
+	})
+	err = ztdb.SaveNDJSON(sqlite.TableTitle, titles)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableTitle, err)
+		return
+	}
+
+	moved := 0
+	for _, system := range systems {
+		tvs, ok := systemTvs[system.Name]
+		if !ok {
+			continue
+		}
+		changed := 0
+		for i, tv := range tvs {
+			if tv.TitleID != before[system.Name][i] {
+				changed++
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		moved += changed
+		err = ztdb.SaveSystemNDJSON(system.Name, tvs)
+		if err != nil {
+			fmt.Println("Unable to save ndjson", system.Name, err)
+			return
+		}
+	}
+	fmt.Println(len(titles), "titles,", created, "created,", len(titles)-len(used), "unused,", moved, "variants regrouped")
+}
+
+// assignGroupIDs gives every group a stable ID, names must be sorted. A group
+// takes the ID byName has for it, then the ID most of its members already have
+// in current, then a new ID above maxID. An ID belongs to one group only,
+// overrides only add members to it. Returns the IDs and the new maxID.
+func assignGroupIDs(names []string, byName map[string]int, current map[string]map[int]int, maxID int) (map[string]int, int) {
+	claimed := make(map[int]bool)
+	groupIDs := make(map[string]int, len(names))
+	for _, name := range names {
+		if id, ok := byName[name]; ok && !claimed[id] {
+			claimed[id] = true
+			groupIDs[name] = id
+		}
+	}
+	for _, name := range names {
+		if _, ok := groupIDs[name]; ok {
+			continue
+		}
+		counts := current[name]
+		best := 0
+		for id, n := range counts {
+			if claimed[id] {
+				continue
+			}
+			if best == 0 || n > counts[best] || (n == counts[best] && id < best) {
+				best = id
+			}
+		}
+		if best == 0 {
+			maxID++
+			best = maxID
+		}
+		claimed[best] = true
+		groupIDs[name] = best
+	}
+	return groupIDs, maxID
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Groups Titles into Works, the same game across systems, without renumbering
+anything. Titles with the same ztdb.GetWorkKey form a work, IDs are kept the
+same way as maketitles keeps title IDs. _WorkOverrides.ndjson pins a title to
+a work when the key gets it wrong, e.g. to split "Tetris" on Game Boy from
+"Tetris" on NES first split the title with a title override, then pin the new
+title to its own work. New works are named after their title with the most
+variants, works keep their names once created.
+*/
+
+const WorkOverridesNDJSON string = "WorkOverrides"
+
+func makeworks() {
+	titles, err := ztdb.LoadNDJSON(sqlite.TableTitle, make([]ztdb.Title, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableTitle, err)
+		return
+	}
+	works, err := ztdb.LoadNDJSON(sqlite.TableWork, make([]ztdb.GenericDBMeta, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", sqlite.TableWork, err)
+		return
+	}
+	overrides, err := ztdb.LoadNDJSON(WorkOverridesNDJSON, make([]ztdb.WorkOverride, 0))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Unable to load ndjson", WorkOverridesNDJSON, err)
+		return
+	}
+	systems, err := ztdb.LoadNDJSON(sqlite.TableSystem, make([]ztdb.System, 0))
+	if err != nil {
+		fmt.Println("Unable to load ndjson", sqlite.TableSystem, err)
+		return
+	}
+
+	variantCounts := make(map[int]int)
+	for _, system := range systems {
+		tvs, err := ztdb.LoadSystemNDJSON(system.Name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			fmt.Println("Unable to load ndjson", system.Name, err)
+			return
+		}
+		for _, tv := range tvs {
+			variantCounts[tv.TitleID]++
+		}
+	}
+
+	workByID := make(map[int]ztdb.GenericDBMeta, len(works))
+	workByKey := make(map[string]int, len(works))
+	maxID := 0
+	for _, w := range works {
+		workByID[w.ID] = w
+		key := workKey(w.Name)
+		if id, ok := workByKey[key]; !ok || w.ID < id {
+			workByKey[key] = w.ID
+		}
+		maxID = max(maxID, w.ID)
+	}
+
+	overrideByTitle := make(map[int]int)
+	for _, o := range overrides {
+		if _, ok := workByID[o.WorkID]; !ok {
+			fmt.Println(WorkOverridesNDJSON, "references unknown work", o.WorkID, "create it in", sqlite.TableWork, "first")
+			return
+		}
+		overrideByTitle[o.TitleID] = o.WorkID
+	}
+
+	before := make([]int, len(titles))
+	groups := make(map[string][]*ztdb.Title)
+	current := make(map[string]map[int]int)
+	for i := range titles {
+		t := &titles[i]
+		before[i] = t.WorkID
+		maxID = max(maxID, t.WorkID)
+		if id, ok := overrideByTitle[t.ID]; ok {
+			t.WorkID = id
+			continue
+		}
+		key := workKey(t.Name)
+		if _, ok := groups[key]; !ok {
+			current[key] = make(map[int]int)
+		}
+		groups[key] = append(groups[key], t)
+		if t.WorkID != 0 {
+			current[key][t.WorkID]++
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	groupIDs, _ := assignGroupIDs(keys, workByKey, current, maxID)
+
+	created := 0
+	used := make(map[int]bool)
+	for _, key := range keys {
+		id := groupIDs[key]
+		used[id] = true
+		if _, ok := workByID[id]; !ok {
+			// the title with the most variants names the work, ties go to the lowest ID
+			var name *ztdb.Title
+			for _, t := range groups[key] {
+				if name == nil || variantCounts[t.ID] > variantCounts[name.ID] ||
+					(variantCounts[t.ID] == variantCounts[name.ID] && t.ID < name.ID) {
+					name = t
+				}
+			}
+			workByID[id] = ztdb.GenericDBMeta{ID: id, Name: name.Name}
+			created++
+		}
+		for _, t := range groups[key] {
+			t.WorkID = id
+		}
+	}
+	for _, id := range overrideByTitle {
+		used[id] = true
+	}
+
+	works = make([]ztdb.GenericDBMeta, 0, len(workByID))
+	for _, w := range workByID {
+		works = append(works, w)
+	}
+	sort.Slice(works, func(i, j int) bool {
+		return works[i].ID < works[j].ID
+	})
+	err = ztdb.SaveNDJSON(sqlite.TableWork, works)
+	if err != nil {
+		fmt.Println("Unable to save ndjson", sqlite.TableWork, err)
+		return
+	}
+
+	moved := 0
+	for i, t := range titles {
+		if t.WorkID != before[i] {
+			moved++
+		}
+	}
+	if moved > 0 {
+		err = ztdb.SaveNDJSON(sqlite.TableTitle, titles)
+		if err != nil {
+			fmt.Println("Unable to save ndjson", sqlite.TableTitle, err)
+			return
+		}
+	}
+	fmt.Println(len(works), "works,", created, "created,", len(works)-len(used), "unused,", moved, "titles regrouped")
+}
+
+// workKey falls back to the name for titles made only of punctuation
+func workKey(name string) string {
+	if key := ztdb.GetWorkKey(name); key != "" {
+		return key
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/match"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+)
+
+/*
+Times match lookups against the built database. Keys are sampled from the
+database itself so every lookup hits, the query plan of each lookup is
+printed to show which index it uses.
+*/
+
+func bench(n int) {
+	db, err := sqlite.OpenZTDB()
+	if err != nil {
+		fmt.Println("Error Opening DB", err)
+		return
+	}
+	defer db.Close()
+
+	samples, err := sqlite.SampleTitleVariants(db, n)
+	if err != nil || len(samples) == 0 {
+		fmt.Println("Error sampling TitleVariants", err)
+		return
+	}
+	fmt.Println("Sampled", len(samples), "TitleVariants")
+
+	columns := []string{
+		sqlite.ColumnSHA1,
+		sqlite.ColumnMD5,
+		sqlite.ColumnCRC,
+		sqlite.ColumnSerial,
+		sqlite.ColumnFilename,
+	}
+	for _, column := range columns {
+		plan, err := sqlite.ExplainFindTitleVariants(db, column)
+		if err != nil {
+			fmt.Println("Error explaining", column, err)
+			return
+		}
+
+		durations := make([]time.Duration, 0, len(samples))
+		for _, tv := range samples {
+			value := map[string]string{
+				sqlite.ColumnSHA1:     tv.SHA1,
+				sqlite.ColumnMD5:      tv.MD5,
+				sqlite.ColumnCRC:      tv.CRC,
+				sqlite.ColumnSerial:   tv.Serial,
+				sqlite.ColumnFilename: tv.Filename,
+			}[column]
+			if value == "" {
+				continue
+			}
+			start := time.Now()
+			_, err := sqlite.FindTitleVariants(db, column, value)
+			if err != nil {
+				fmt.Println("Error looking up", column, value, err)
+				return
+			}
+			durations = append(durations, time.Since(start))
+		}
+		printDurations(column, durations)
+		fmt.Println("  plan:", strings.Join(plan, "; "))
+	}
+
+	// A full Lookup as the matcher runs it, by the best key each sample has
+	matcher := match.NewMatcher(db)
+	durations := make([]time.Duration, 0, len(samples))
+	for _, tv := range samples {
+		h := match.Hashes{Size: int64(tv.Size), CRC: tv.CRC, MD5: tv.MD5, SHA1: tv.SHA1}
+		start := time.Now()
+		_, err := matcher.Lookup(h, nil, tv.Filename)
+		if err != nil {
+			fmt.Println("Error looking up", tv.ID, err)
+			return
+		}
+		durations = append(durations, time.Since(start))
+	}
+	printDurations("Lookup", durations)
+}
+
+func printDurations(name string, durations []time.Duration) {
+	if len(durations) == 0 {
+		fmt.Printf("%-10v no samples\n", name)
+		return
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	percentile := func(p int) time.Duration {
+		return durations[(len(durations)-1)*p/100]
+	}
+	fmt.Printf("%-10v n=%-6v mean=%-10v p50=%-10v p99=%-10v max=%v\n",
+		name, len(durations), total/time.Duration(len(durations)), percentile(50), percentile(99), durations[len(durations)-1])
+}
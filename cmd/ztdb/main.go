@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/match"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+)
+
+/*
+Consumer side commands that read the built sqlite database.
+*/
+
+const (
+	CMDscan   string = "scan"
+	CMDbench  string = "bench"
+	CMDsearch string = "search"
+	CMDserve  string = "serve"
+)
+
+func main() {
+	cmdPtr := flag.String("cmd", "", "[scan, bench, search, serve]")
+	pathPtr := flag.String("path", ".", "directory to scan")
+	fullHashPtr := flag.Bool("fullhash", false, "hash archive entries even when the stored CRC32 matches")
+	samplesPtr := flag.Int("n", 1000, "number of TitleVariants to sample for bench")
+	queryPtr := flag.String("query", "", "text to search for")
+	systemPtr := flag.String("system", "", "only search or scan this system, e.g. \"Nintendo - Game Boy.rdb\"")
+	regionPtr := flag.String("region", "", "only search this region, e.g. USA")
+	languagePtr := flag.String("language", "", "only search this language, e.g. en")
+	limitPtr := flag.Int("limit", 50, "maximum number of search results")
+	addrPtr := flag.String("addr", "127.0.0.1:8080", "address for serve to listen on")
+	flag.Parse()
+
+	switch *cmdPtr {
+	case CMDscan:
+		scan(*pathPtr, *systemPtr, *fullHashPtr)
+	case CMDbench:
+		bench(*samplesPtr)
+	case CMDsearch:
+		search(*queryPtr, *systemPtr, *regionPtr, *languagePtr, *limitPtr)
+	case CMDserve:
+		serve(*addrPtr)
+	default:
+		fmt.Println("no cmd to run")
+	}
+}
+
+// scan prints one NDJSON match record per file under dir
+func scan(dir string, system string, fullHash bool) {
+	db, err := sqlite.OpenZTDB()
+	if err != nil {
+		fmt.Println("Error Opening DB", err)
+		return
+	}
+	defer db.Close()
+
+	matcher := match.NewMatcher(db)
+	matcher.FullHash = fullHash
+	if system != "" {
+		matcher.SystemID, err = sqlite.GetMetaNameID(db, sqlite.TableSystem, system)
+		if err != nil {
+			fmt.Println("Unknown", sqlite.TableSystem, system, err)
+			return
+		}
+	}
+	err = matcher.ScanDir(dir, func(m match.Match, err error) {
+		if err != nil {
+			fmt.Println("Error scanning", m.Path, err)
+			return
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			fmt.Println("Error marshalling match", m.Path, err)
+			return
+		}
+		fmt.Println(string(b))
+	})
+	if err != nil {
+		fmt.Println("Error scanning", dir, err)
+	}
+}
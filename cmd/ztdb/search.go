@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+)
+
+// search prints one NDJSON result per ranked match, filters are given by
+// name and ignored when empty
+func search(text string, system string, region string, language string, limit int) {
+	db, err := sqlite.OpenZTDB()
+	if err != nil {
+		fmt.Println("Error Opening DB", err)
+		return
+	}
+	defer db.Close()
+
+	opts := sqlite.SearchOptions{Limit: limit}
+	filters := []struct {
+		table string
+		name  string
+		id    *int
+	}{
+		{sqlite.TableSystem, system, &opts.SystemID},
+		{sqlite.TableRegion, region, &opts.RegionID},
+		{sqlite.TableLanguage, language, &opts.LanguageID},
+	}
+	for _, filter := range filters {
+		if filter.name == "" {
+			continue
+		}
+		if filter.table == sqlite.TableRegion {
+			*filter.id, err = sqlite.GetRegionID(db, filter.name)
+		} else {
+			*filter.id, err = sqlite.GetMetaNameID(db, filter.table, filter.name)
+		}
+		if err != nil {
+			fmt.Println("Unknown", filter.table, filter.name, err)
+			return
+		}
+	}
+
+	results, err := sqlite.SearchTitleVariants(db, text, opts)
+	if err != nil {
+		fmt.Println("Error searching", text, err)
+		return
+	}
+	for _, r := range results {
+		b, err := json.Marshal(r)
+		if err != nil {
+			fmt.Println("Error marshalling result", r.Variant.ID, err)
+			return
+		}
+		fmt.Println(string(b))
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/lookup"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Read only HTTP/JSON service over the lookup API for tools not written in Go.
+
+	GET  /systems?zaparoo=
+	GET  /languages
+	GET  /regions
+	GET  /lookup/sha1/{sha1}
+	GET  /lookup/md5/{md5}
+	GET  /lookup/crc/{crc}?size=
+	GET  /lookup/serial/{serial}?system=|zaparoo=
+	GET  /lookup/filename/{filename}?system=|zaparoo=
+	POST /lookup        one lookup.Query, returns the best lookup.Result
+	POST /lookup/batch  up to maxBatchQueries lookup.Query, results in order
+	GET  /search?q=&system=&region=&language=&limit=
+	GET  /titles/{id}
+	GET  /titles/{id}/preferred?region=&language=&system=|zaparoo=
+	GET  /titles/{id}/playable?region=&system=|zaparoo=
+	GET  /works/{id}    every variant of the game across systems
+
+system, region and language are IDs, zaparoo is a Zaparoo Core system ID
+such as "PSX" and covers every system mapped to it. For preferred, region and
+language are comma separated names best first, e.g. region=USA,Europe. For
+playable, region is one name, ISO code or alias, e.g. region=DE also returns
+Europe and World releases. Errors are returned as {"error": "..."}.
+*/
+
+const maxBatchQueries = 1000
+
+// Request bodies are read up to these sizes, a batch of maxBatchQueries fits
+const (
+	maxQueryBytes = 64 << 10
+	maxBatchBytes = 1 << 20
+)
+
+type titleDetail struct {
+	TitleID  int                       `json:"title_id"`
+	Title    string                    `json:"title"`
+	Variants []ztdb.TitleVariantRecord `json:"variants"`
+}
+
+type workDetail struct {
+	WorkID   int                       `json:"work_id"`
+	Work     string                    `json:"work"`
+	Variants []ztdb.TitleVariantRecord `json:"variants"`
+}
+
+func serve(addr string) {
+	db, err := lookup.Open(settings.DBPath)
+	if err != nil {
+		fmt.Println("Error Opening DB", err)
+		return
+	}
+	defer db.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /systems", func(w http.ResponseWriter, r *http.Request) {
+		if zaparooID := r.URL.Query().Get("zaparoo"); zaparooID != "" {
+			systems, err := db.SystemsByZaparooID(zaparooID)
+			writeJSON(w, systems, err)
+			return
+		}
+		systems, err := db.Systems()
+		writeJSON(w, systems, err)
+	})
+	mux.HandleFunc("GET /languages", func(w http.ResponseWriter, r *http.Request) {
+		languages, err := db.Languages()
+		writeJSON(w, languages, err)
+	})
+	mux.HandleFunc("GET /regions", func(w http.ResponseWriter, r *http.Request) {
+		regions, err := db.Regions()
+		writeJSON(w, regions, err)
+	})
+	mux.HandleFunc("GET /lookup/sha1/{sha1}", func(w http.ResponseWriter, r *http.Request) {
+		records, err := db.BySHA1(r.PathValue("sha1"))
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("GET /lookup/md5/{md5}", func(w http.ResponseWriter, r *http.Request) {
+		records, err := db.ByMD5(r.PathValue("md5"))
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("GET /lookup/crc/{crc}", func(w http.ResponseWriter, r *http.Request) {
+		size, err := queryInt(r, "size")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		records, err := db.ByCRC(r.PathValue("crc"), int64(size))
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("GET /lookup/serial/{serial}", func(w http.ResponseWriter, r *http.Request) {
+		systemID, zaparooID, err := querySystem(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if zaparooID != "" {
+			records, err := db.BySerialZaparoo(r.PathValue("serial"), zaparooID)
+			writeJSON(w, records, err)
+			return
+		}
+		records, err := db.BySerial(r.PathValue("serial"), systemID)
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("GET /lookup/filename/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		systemID, zaparooID, err := querySystem(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if zaparooID != "" {
+			records, err := db.ByFilenameZaparoo(r.PathValue("filename"), zaparooID)
+			writeJSON(w, records, err)
+			return
+		}
+		records, err := db.ByFilename(r.PathValue("filename"), systemID)
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("POST /lookup", func(w http.ResponseWriter, r *http.Request) {
+		var q lookup.Query
+		if status, err := decodeBody(w, r, maxQueryBytes, &q); err != nil {
+			writeError(w, status, err)
+			return
+		}
+		result, err := db.Lookup(q)
+		writeJSON(w, result, err)
+	})
+	mux.HandleFunc("POST /lookup/batch", func(w http.ResponseWriter, r *http.Request) {
+		var queries []lookup.Query
+		if status, err := decodeBody(w, r, maxBatchBytes, &queries); err != nil {
+			writeError(w, status, err)
+			return
+		}
+		if len(queries) > maxBatchQueries {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("at most %v queries per batch", maxBatchQueries))
+			return
+		}
+		results := make([]lookup.Result, 0, len(queries))
+		for _, q := range queries {
+			result, err := db.Lookup(q)
+			if err != nil {
+				writeJSON(w, nil, err)
+				return
+			}
+			results = append(results, result)
+		}
+		writeJSON(w, results, nil)
+	})
+	mux.HandleFunc("GET /search", func(w http.ResponseWriter, r *http.Request) {
+		var opts sqlite.SearchOptions
+		for param, dst := range map[string]*int{
+			"system":   &opts.SystemID,
+			"region":   &opts.RegionID,
+			"language": &opts.LanguageID,
+			"limit":    &opts.Limit,
+		} {
+			n, err := queryInt(r, param)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			*dst = n
+		}
+		results, err := db.Search(r.URL.Query().Get("q"), opts)
+		if errors.Is(err, sqlite.ErrNoFTS5) {
+			writeError(w, http.StatusNotImplemented, err)
+			return
+		}
+		writeJSON(w, results, err)
+	})
+	mux.HandleFunc("GET /titles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		titleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid title id %q", r.PathValue("id")))
+			return
+		}
+		records, err := db.ByTitleID(titleID)
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		if len(records) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("title %v not found", titleID))
+			return
+		}
+		writeJSON(w, titleDetail{TitleID: titleID, Title: records[0].Title, Variants: records}, nil)
+	})
+	mux.HandleFunc("GET /titles/{id}/preferred", func(w http.ResponseWriter, r *http.Request) {
+		titleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid title id %q", r.PathValue("id")))
+			return
+		}
+		systemID, zaparooID, err := querySystem(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		record, ok, err := db.PreferredVariant(titleID, lookup.Preferences{
+			Regions:         queryList(r, "region"),
+			Languages:       queryList(r, "language"),
+			SystemID:        systemID,
+			ZaparooSystemID: zaparooID,
+		})
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("title %v has no variant on that system", titleID))
+			return
+		}
+		writeJSON(w, record, nil)
+	})
+	mux.HandleFunc("GET /titles/{id}/playable", func(w http.ResponseWriter, r *http.Request) {
+		titleID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid title id %q", r.PathValue("id")))
+			return
+		}
+		systemID, zaparooID, err := querySystem(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		records, err := db.PlayableIn(r.URL.Query().Get("region"), sqlite.RecordFilter{
+			TitleID:         titleID,
+			SystemID:        systemID,
+			ZaparooSystemID: zaparooID,
+		})
+		if errors.Is(err, lookup.ErrUnknownRegion) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, records, err)
+	})
+	mux.HandleFunc("GET /works/{id}", func(w http.ResponseWriter, r *http.Request) {
+		workID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid work id %q", r.PathValue("id")))
+			return
+		}
+		records, err := db.ByWorkID(workID)
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		if len(records) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("work %v not found", workID))
+			return
+		}
+		writeJSON(w, workDetail{WorkID: workID, Work: records[0].Work, Variants: records}, nil)
+	})
+
+	fmt.Println("Serving", settings.DBPath, "on", addr)
+	err = http.ListenAndServe(addr, mux)
+	if err != nil {
+		fmt.Println("Error serving", addr, err)
+	}
+}
+
+func queryInt(r *http.Request, param string) (int, error) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v %q", param, value)
+	}
+	return n, nil
+}
+
+func queryList(r *http.Request, param string) []string {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// decodeBody reads a JSON body of at most limit bytes into v, returning the
+// status to reply with when it can't
+func decodeBody(w http.ResponseWriter, r *http.Request, limit int64, v any) (int, error) {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("request body over %v bytes", limit)
+	} else if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// querySystem reads either a system ID or a Zaparoo system ID, not both
+func querySystem(r *http.Request) (int, string, error) {
+	systemID, err := queryInt(r, "system")
+	if err != nil {
+		return 0, "", err
+	}
+	zaparooID := r.URL.Query().Get("zaparoo")
+	if systemID != 0 && zaparooID != "" {
+		return 0, "", errors.New("use either system or zaparoo, not both")
+	}
+	return systemID, zaparooID, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -2,4 +2,20 @@ module github.com/ZaparooProject/zaparoo-titles-database
 
 go 1.23.5
 
-require github.com/mattn/go-sqlite3 v1.14.28 // indirect
+require (
+	github.com/bodgit/sevenzip v1.6.1
+	github.com/klauspost/compress v1.17.11
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/ulikunitz/xz v0.5.12
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/pierrec/lz4/v4 v4.1.22 // indirect
+	github.com/spf13/afero v1.11.0 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
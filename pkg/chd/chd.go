@@ -0,0 +1,184 @@
+package chd
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Reads the header and metadata of MAME CHD v5 files, hunks are only
+decompressed when a track is read. CD track layouts come from CHT2/CHTR/CHGD
+metadata, DVDs have none.
+*/
+
+const (
+	chdMagic      = "MComprHD"
+	chdV5Length   = 124
+	cdFrameSize   = 2352
+	metaHeaderLen = 16
+)
+
+// Metadata tags
+const (
+	TagCDTrack  = "CHTR"
+	TagCDTrack2 = "CHT2"
+	TagGDTrack  = "CHGD"
+	TagDVD      = "DVD "
+	TagHardDisk = "GDDD"
+)
+
+type Track struct {
+	Number  int
+	Type    string
+	SubType string
+	Frames  int
+	Pregap  int
+	PGType  string
+	Postgap int
+}
+
+// Size is the size of the track as a raw 2352 byte sector BIN file, pregap
+// frames stored in the CHD (PGTYPE V*) are already counted in Frames.
+func (t Track) Size() int64 {
+	frames := t.Frames
+	if t.Pregap > 0 && !strings.HasPrefix(t.PGType, "V") {
+		frames += t.Pregap
+	}
+	return int64(frames) * cdFrameSize
+}
+
+type Metadata struct {
+	Tag  string
+	Data []byte
+}
+
+type Header struct {
+	Version      uint32
+	Compressors  [4]string
+	LogicalBytes uint64
+	MapOffset    uint64
+	MetaOffset   uint64
+	HunkBytes    uint32
+	UnitBytes    uint32
+	// RawSHA1 covers the uncompressed data only, SHA1 also covers metadata
+	RawSHA1    string
+	SHA1       string
+	ParentSHA1 string
+}
+
+type CHD struct {
+	Header   Header
+	Metadata []Metadata
+	Tracks   []Track
+}
+
+// IsDVD reports whether the raw data is a plain 2048 byte sector image, in
+// which case RawSHA1 is the SHA1 of the equivalent ISO.
+func (c CHD) IsDVD() bool {
+	for _, meta := range c.Metadata {
+		if meta.Tag == TagDVD {
+			return true
+		}
+	}
+	return false
+}
+
+func Open(path string) (CHD, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return CHD{}, err
+	}
+	defer f.Close()
+	c, err := Read(f)
+	if err != nil {
+		return c, fmt.Errorf("%v: %w", path, err)
+	}
+	return c, nil
+}
+
+func Read(r io.ReaderAt) (CHD, error) {
+	var c CHD
+	buf := make([]byte, chdV5Length)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return c, err
+	}
+	if string(buf[:8]) != chdMagic {
+		return c, errors.New("not a CHD file")
+	}
+	c.Header.Version = binary.BigEndian.Uint32(buf[12:])
+	if c.Header.Version != 5 {
+		return c, fmt.Errorf("unsupported CHD version %v", c.Header.Version)
+	}
+
+	h := &c.Header
+	for i := range h.Compressors {
+		h.Compressors[i] = strings.TrimRight(string(buf[16+i*4:20+i*4]), "\x00")
+	}
+	h.LogicalBytes = binary.BigEndian.Uint64(buf[32:])
+	h.MapOffset = binary.BigEndian.Uint64(buf[40:])
+	h.MetaOffset = binary.BigEndian.Uint64(buf[48:])
+	h.HunkBytes = binary.BigEndian.Uint32(buf[56:])
+	h.UnitBytes = binary.BigEndian.Uint32(buf[60:])
+	h.RawSHA1 = strings.ToUpper(hex.EncodeToString(buf[64:84]))
+	h.SHA1 = strings.ToUpper(hex.EncodeToString(buf[84:104]))
+	h.ParentSHA1 = strings.ToUpper(hex.EncodeToString(buf[104:124]))
+
+	offset := h.MetaOffset
+	seen := make(map[uint64]bool)
+	for offset != 0 && !seen[offset] {
+		seen[offset] = true
+		mh := make([]byte, metaHeaderLen)
+		if _, err := r.ReadAt(mh, int64(offset)); err != nil {
+			return c, fmt.Errorf("reading metadata: %w", err)
+		}
+		length := binary.BigEndian.Uint32(mh[4:]) & 0x00ffffff
+		data := make([]byte, length)
+		if _, err := r.ReadAt(data, int64(offset)+metaHeaderLen); err != nil {
+			return c, fmt.Errorf("reading metadata: %w", err)
+		}
+		meta := Metadata{Tag: string(mh[:4]), Data: data}
+		c.Metadata = append(c.Metadata, meta)
+		switch meta.Tag {
+		case TagCDTrack, TagCDTrack2, TagGDTrack:
+			c.Tracks = append(c.Tracks, parseTrack(meta.Data))
+		}
+		offset = binary.BigEndian.Uint64(mh[8:])
+	}
+	return c, nil
+}
+
+// parseTrack reads "TRACK:1 TYPE:MODE2_RAW SUBTYPE:NONE FRAMES:1234 ..."
+func parseTrack(data []byte) Track {
+	var t Track
+	text := strings.TrimRight(string(data), "\x00")
+	for _, field := range strings.Fields(text) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.Atoi(value)
+		switch key {
+		case "TRACK":
+			t.Number = n
+		case "TYPE":
+			t.Type = value
+		case "SUBTYPE":
+			t.SubType = value
+		case "FRAMES":
+			t.Frames = n
+		case "PREGAP":
+			t.Pregap = n
+		case "PGTYPE":
+			t.PGType = value
+		case "POSTGAP":
+			t.Postgap = n
+		}
+	}
+	return t
+}
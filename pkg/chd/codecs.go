@@ -0,0 +1,182 @@
+package chd
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Compressor tags
+const (
+	CodecZlib     = "zlib"
+	CodecLZMA     = "lzma"
+	CodecZstd     = "zstd"
+	CodecCDZlib   = "cdzl"
+	CodecCDLZMA   = "cdlz"
+	CodecCDZstd   = "cdzs"
+	CodecCDFLAC   = "cdfl"
+	cdSubcodeSize = 96
+	// cdUnitSize is a frame and its subcode as stored in CD hunks
+	cdUnitSize = cdFrameSize + cdSubcodeSize
+)
+
+type decompressor interface {
+	// decompress fills all of dest from src
+	decompress(src []byte, dest []byte) error
+}
+
+// newDecompressor supports the codecs chdman uses for CDs and the plain codecs
+// they're built on, DVDs are matched by their header SHA1 and never read.
+func newDecompressor(tag string) (decompressor, error) {
+	switch tag {
+	case CodecZlib:
+		return zlibCodec{}, nil
+	case CodecLZMA:
+		return lzmaCodec{}, nil
+	case CodecZstd:
+		return zstdCodec{}, nil
+	case CodecCDZlib:
+		return cdCodec{base: zlibCodec{}, subcode: zlibCodec{}}, nil
+	case CodecCDLZMA:
+		return cdCodec{base: lzmaCodec{}, subcode: zlibCodec{}}, nil
+	case CodecCDZstd:
+		return cdCodec{base: zstdCodec{}, subcode: zstdCodec{}}, nil
+	case CodecCDFLAC:
+		return cdFLACCodec{}, nil
+	}
+	return nil, fmt.Errorf("unsupported CHD codec %q", tag)
+}
+
+var errShortHunk = errors.New("decompressed data is short")
+
+// zlibCodec is raw deflate without a zlib header
+type zlibCodec struct{}
+
+func (zlibCodec) decompress(src []byte, dest []byte) error {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	_, err := io.ReadFull(r, dest)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return errShortHunk
+	}
+	return err
+}
+
+// lzmaCodec is a raw LZMA stream with lc=3 lp=0 pb=2 and no end marker
+type lzmaCodec struct{}
+
+func (lzmaCodec) decompress(src []byte, dest []byte) error {
+	header := make([]byte, lzma.HeaderLen)
+	header[0] = (2*5+0)*9 + 3
+	dictCap := max(len(dest), lzma.MinDictCap)
+	binary.LittleEndian.PutUint32(header[1:], uint32(dictCap))
+	binary.LittleEndian.PutUint64(header[5:], uint64(len(dest)))
+	r, err := lzma.NewReader(io.MultiReader(bytes.NewReader(header), bytes.NewReader(src)))
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(r, dest)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return errShortHunk
+	}
+	return err
+}
+
+type zstdCodec struct{}
+
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+
+func (zstdCodec) decompress(src []byte, dest []byte) error {
+	out, err := zstdDecoder.DecodeAll(src, dest[:0])
+	if err != nil {
+		return err
+	}
+	if len(out) != len(dest) {
+		return errShortHunk
+	}
+	copy(dest, out)
+	return nil
+}
+
+// cdCodec splits CD hunks into sector data and subcode compressed apart. The
+// data is preceded by a bit per frame whose sync header and ECC were removed
+// and need regenerating, and by the length of the compressed data.
+type cdCodec struct {
+	base    decompressor
+	subcode decompressor
+}
+
+func (c cdCodec) decompress(src []byte, dest []byte) error {
+	frames := len(dest) / cdUnitSize
+	eccBytes := (frames + 7) / 8
+	lengthBytes := 2
+	if len(dest) >= 65536 {
+		lengthBytes = 3
+	}
+	if len(src) < eccBytes+lengthBytes {
+		return io.ErrUnexpectedEOF
+	}
+	baseLength := int(src[eccBytes])<<8 | int(src[eccBytes+1])
+	if lengthBytes == 3 {
+		baseLength = baseLength<<8 | int(src[eccBytes+2])
+	}
+	start := eccBytes + lengthBytes
+	if start+baseLength > len(src) {
+		return io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, frames*cdUnitSize)
+	err := c.base.decompress(src[start:start+baseLength], buf[:frames*cdFrameSize])
+	if err != nil {
+		return err
+	}
+	err = c.subcode.decompress(src[start+baseLength:], buf[frames*cdFrameSize:])
+	if err != nil {
+		return err
+	}
+	interleave(dest, buf, frames)
+
+	for n := range frames {
+		if src[n/8]&(1<<(n%8)) != 0 {
+			sector := dest[n*cdUnitSize : n*cdUnitSize+cdFrameSize]
+			copy(sector, cdSync)
+			eccGenerate(sector)
+		}
+	}
+	return nil
+}
+
+// cdFLACCodec stores frames as 16 bit big-endian stereo FLAC followed by the
+// deflated subcode.
+type cdFLACCodec struct{}
+
+func (cdFLACCodec) decompress(src []byte, dest []byte) error {
+	frames := len(dest) / cdUnitSize
+	buf := make([]byte, frames*cdUnitSize)
+	n, err := decodeFLAC(src, buf[:frames*cdFrameSize])
+	if err != nil {
+		return err
+	}
+	err = zlibCodec{}.decompress(src[n:], buf[frames*cdFrameSize:])
+	if err != nil {
+		return err
+	}
+	interleave(dest, buf, frames)
+	return nil
+}
+
+// interleave puts each frame's subcode after its data, buf holds the data of
+// every frame followed by every subcode
+func interleave(dest []byte, buf []byte, frames int) {
+	for n := range frames {
+		copy(dest[n*cdUnitSize:], buf[n*cdFrameSize:(n+1)*cdFrameSize])
+		subcode := frames*cdFrameSize + n*cdSubcodeSize
+		copy(dest[n*cdUnitSize+cdFrameSize:], buf[subcode:subcode+cdSubcodeSize])
+	}
+}
@@ -0,0 +1,52 @@
+package chd
+
+// cdSync starts every data sector
+var cdSync = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// Reed-Solomon product code layout of a MODE1 sector, P parity covers the
+// header and user data, Q parity also covers P
+const (
+	eccPOffset = 0x81c
+	eccQOffset = 0x8c8
+)
+
+var eccFLUT, eccBLUT = func() ([256]byte, [256]byte) {
+	var f, b [256]byte
+	for i := range 256 {
+		j := i << 1
+		if i&0x80 != 0 {
+			j ^= 0x11d
+		}
+		f[i] = byte(j)
+		b[i^j] = byte(i)
+	}
+	return f, b
+}()
+
+// eccGenerate recomputes the P and Q parity of a 2352 byte MODE1 sector, CD
+// codecs drop them when they can be regenerated.
+func eccGenerate(sector []byte) {
+	eccBlock(sector[0xc:], 86, 24, 2, 86, sector[eccPOffset:])
+	eccBlock(sector[0xc:], 52, 43, 86, 88, sector[eccQOffset:])
+}
+
+func eccBlock(src []byte, majorCount, minorCount, majorMult, minorInc int, dest []byte) {
+	size := majorCount * minorCount
+	for major := range majorCount {
+		index := (major>>1)*majorMult + major&1
+		var a, b byte
+		for range minorCount {
+			v := src[index]
+			index += minorInc
+			if index >= size {
+				index -= size
+			}
+			a ^= v
+			b ^= v
+			a = eccFLUT[a]
+		}
+		a = eccBLUT[eccFLUT[a]^b]
+		dest[major] = a
+		dest[major+majorCount] = a ^ b
+	}
+}
@@ -0,0 +1,279 @@
+package chd
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+Decodes the bare FLAC frames of cdfl hunks. There's no stream header, every
+frame is 16 bit stereo and carries its own block size.
+*/
+
+var errFLAC = errors.New("invalid FLAC frame")
+
+// decodeFLAC fills dest with big-endian 16 bit stereo samples, returning the
+// number of bytes of src the frames used.
+func decodeFLAC(src []byte, dest []byte) (int, error) {
+	b := newBitReader(src)
+	var samples [2][]int32
+	out := 0
+	for out < len(dest) {
+		blockSize, err := decodeFLACFrame(b, &samples)
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < blockSize && out < len(dest); i++ {
+			for ch := range 2 {
+				v := uint16(samples[ch][i])
+				dest[out] = byte(v >> 8)
+				dest[out+1] = byte(v)
+				out += 2
+			}
+		}
+	}
+	return b.consumed(), nil
+}
+
+func decodeFLACFrame(b *bitReader, samples *[2][]int32) (int, error) {
+	if b.read(14) != 0x3ffe {
+		return 0, errFLAC
+	}
+	b.read(2)
+	blockCode := b.read(4)
+	rateCode := b.read(4)
+	channels := b.read(4)
+	sizeCode := b.read(3)
+	b.read(1)
+	if sizeCode != 0 && sizeCode != 4 {
+		return 0, fmt.Errorf("unsupported FLAC sample size code %v", sizeCode)
+	}
+	switch channels {
+	case 1, 8, 9, 10:
+		// independent, left/side, side/right and mid/side stereo
+	default:
+		return 0, fmt.Errorf("unsupported FLAC channel assignment %v", channels)
+	}
+
+	// frame number, UTF-8 coded
+	first := b.read(8)
+	for first&0xc0 == 0xc0 {
+		if b.read(8)&0xc0 != 0x80 {
+			return 0, errFLAC
+		}
+		first = first << 1 & 0xff
+	}
+
+	var blockSize int
+	switch {
+	case blockCode == 1:
+		blockSize = 192
+	case blockCode >= 2 && blockCode <= 5:
+		blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		blockSize = int(b.read(8)) + 1
+	case blockCode == 7:
+		blockSize = int(b.read(16)) + 1
+	case blockCode >= 8:
+		blockSize = 256 << (blockCode - 8)
+	default:
+		return 0, errFLAC
+	}
+	switch rateCode {
+	case 12:
+		b.read(8)
+	case 13, 14:
+		b.read(16)
+	case 15:
+		return 0, errFLAC
+	}
+	// header CRC-8, hunks are checked by their own CRC16
+	b.read(8)
+
+	for ch := range 2 {
+		if cap(samples[ch]) < blockSize {
+			samples[ch] = make([]int32, blockSize)
+		}
+		samples[ch] = samples[ch][:blockSize]
+		bps := uint(16)
+		if (channels == 8 || channels == 10) && ch == 1 || channels == 9 && ch == 0 {
+			// the side channel needs an extra bit
+			bps++
+		}
+		err := decodeFLACSubframe(b, samples[ch], bps)
+		if err != nil {
+			return 0, err
+		}
+	}
+	b.align()
+	// frame CRC-16
+	b.read(16)
+	if b.overflow() {
+		return 0, errFLAC
+	}
+
+	left, right := samples[0], samples[1]
+	switch channels {
+	case 8:
+		for i := range left {
+			right[i] = left[i] - right[i]
+		}
+	case 9:
+		for i := range left {
+			left[i] += right[i]
+		}
+	case 10:
+		for i := range left {
+			mid := left[i]<<1 | right[i]&1
+			side := right[i]
+			left[i] = (mid + side) >> 1
+			right[i] = (mid - side) >> 1
+		}
+	}
+	return blockSize, nil
+}
+
+func signExtend(v uint32, bits uint) int32 {
+	if bits == 0 {
+		return 0
+	}
+	return int32(v<<(32-bits)) >> (32 - bits)
+}
+
+var fixedCoefs = [][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+func decodeFLACSubframe(b *bitReader, s []int32, bps uint) error {
+	if b.read(1) != 0 {
+		return errFLAC
+	}
+	kind := b.read(6)
+	wasted := uint(0)
+	if b.read(1) == 1 {
+		wasted = uint(b.unary()) + 1
+		if wasted >= bps {
+			return errFLAC
+		}
+		bps -= wasted
+	}
+
+	switch {
+	case kind == 0:
+		v := signExtend(b.read(bps), bps)
+		for i := range s {
+			s[i] = v
+		}
+	case kind == 1:
+		for i := range s {
+			s[i] = signExtend(b.read(bps), bps)
+		}
+	case kind >= 8 && kind <= 12:
+		order := int(kind - 8)
+		if order > len(s) {
+			return errFLAC
+		}
+		for i := range order {
+			s[i] = signExtend(b.read(bps), bps)
+		}
+		err := decodeResidual(b, s, order)
+		if err != nil {
+			return err
+		}
+		predict(s, fixedCoefs[order], 0)
+	case kind >= 32:
+		order := int(kind - 31)
+		if order > len(s) {
+			return errFLAC
+		}
+		for i := range order {
+			s[i] = signExtend(b.read(bps), bps)
+		}
+		precision := uint(b.read(4)) + 1
+		if precision == 16 {
+			return errFLAC
+		}
+		shift := signExtend(b.read(5), 5)
+		if shift < 0 {
+			return errFLAC
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = int64(signExtend(b.read(precision), precision))
+		}
+		err := decodeResidual(b, s, order)
+		if err != nil {
+			return err
+		}
+		predict(s, coefs, uint(shift))
+	default:
+		return errFLAC
+	}
+
+	if wasted > 0 {
+		for i := range s {
+			s[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// decodeResidual reads the rice coded residual after the warm-up samples
+func decodeResidual(b *bitReader, s []int32, order int) error {
+	method := b.read(2)
+	if method > 1 {
+		return errFLAC
+	}
+	paramBits, escape := uint(4), uint32(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partitionOrder := b.read(4)
+	partitions := 1 << partitionOrder
+	perPartition := len(s) >> partitionOrder
+	if perPartition<<partitionOrder != len(s) || perPartition < order {
+		return errFLAC
+	}
+
+	i := order
+	for p := range partitions {
+		n := perPartition
+		if p == 0 {
+			n -= order
+		}
+		param := b.read(paramBits)
+		if param == escape {
+			bits := uint(b.read(5))
+			for range n {
+				s[i] = signExtend(b.read(bits), bits)
+				i++
+			}
+			continue
+		}
+		for range n {
+			v := b.unary()<<param | b.read(uint(param))
+			s[i] = int32(v>>1) ^ -int32(v&1)
+			i++
+		}
+		if b.overflow() {
+			return errFLAC
+		}
+	}
+	return nil
+}
+
+// predict turns the residual after the warm-up samples into samples
+func predict(s []int32, coefs []int64, shift uint) {
+	order := len(coefs)
+	for i := order; i < len(s); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * int64(s[i-1-j])
+		}
+		s[i] += int32(sum >> shift)
+	}
+}
@@ -0,0 +1,101 @@
+package chd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// writeFixed2 writes a fixed order 2 subframe with a single rice partition
+func writeFixed2(w *bitWriter, s []int32, bps uint) {
+	const k = 6
+	w.write(0, 1)
+	w.write(8+2, 6)
+	w.write(0, 1)
+	w.write(uint32(s[0]), bps)
+	w.write(uint32(s[1]), bps)
+	w.write(0, 2)
+	w.write(0, 4)
+	w.write(k, 4)
+	for i := 2; i < len(s); i++ {
+		r := s[i] - 2*s[i-1] + s[i-2]
+		u := uint32(r<<1 ^ r>>31)
+		for range u >> k {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(u&(1<<k-1), k)
+	}
+}
+
+func writeVerbatim(w *bitWriter, s []int32, bps uint) {
+	w.write(0, 1)
+	w.write(1, 6)
+	w.write(0, 1)
+	for _, v := range s {
+		w.write(uint32(v), bps)
+	}
+}
+
+func TestDecodeFLAC(t *testing.T) {
+	const samples = 300
+	left := make([]int32, samples)
+	right := make([]int32, samples)
+	want := make([]byte, 0, samples*4)
+	for i := range samples {
+		left[i] = int32(i*97%2000) - 1000
+		right[i] = int32(-i * 3)
+		want = append(want, byte(uint16(left[i])>>8), byte(left[i]), byte(uint16(right[i])>>8), byte(right[i]))
+	}
+
+	// an independent stereo frame of 100 samples and a mid/side frame of 200
+	w := &bitWriter{}
+	frames := []struct {
+		channels uint32
+		from, to int
+	}{
+		{1, 0, 100},
+		{10, 100, samples},
+	}
+	for _, f := range frames {
+		w.write(0x3ffe, 14)
+		w.write(0, 2)
+		w.write(6, 4)
+		w.write(9, 4)
+		w.write(f.channels, 4)
+		w.write(4, 3)
+		w.write(0, 1)
+		w.write(0, 8)
+		w.write(uint32(f.to-f.from-1), 8)
+		w.write(0, 8)
+		l, r := left[f.from:f.to], right[f.from:f.to]
+		if f.channels == 1 {
+			writeFixed2(w, l, 16)
+			writeVerbatim(w, r, 16)
+		} else {
+			mid := make([]int32, len(l))
+			side := make([]int32, len(l))
+			for i := range l {
+				mid[i] = (l[i] + r[i]) >> 1
+				side[i] = l[i] - r[i]
+			}
+			writeFixed2(w, mid, 16)
+			writeVerbatim(w, side, 17)
+		}
+		w.align()
+		w.write(0, 16)
+	}
+	frameBytes := len(w.data)
+	src := append(w.data, 0xaa, 0xbb)
+
+	got := make([]byte, len(want))
+	n, err := decodeFLAC(src, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != frameBytes {
+		t.Errorf("decodeFLAC used %v bytes, want %v", n, frameBytes)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("decoded samples differ")
+	}
+}
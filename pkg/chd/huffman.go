@@ -0,0 +1,184 @@
+package chd
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// bitReader reads MSB first bit fields, reading past the end returns zeros
+// and is reported by overflow.
+type bitReader struct {
+	data  []byte
+	off   int
+	buf   uint64
+	nbits uint
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+func (b *bitReader) fill() {
+	for b.nbits <= 56 {
+		var c byte
+		if b.off < len(b.data) {
+			c = b.data[b.off]
+		}
+		b.off++
+		b.buf |= uint64(c) << (56 - b.nbits)
+		b.nbits += 8
+	}
+}
+
+// peek returns the next n bits, n is at most 32
+func (b *bitReader) peek(n uint) uint32 {
+	if b.nbits < n {
+		b.fill()
+	}
+	return uint32(b.buf >> (64 - n))
+}
+
+func (b *bitReader) remove(n uint) {
+	if b.nbits < n {
+		b.fill()
+	}
+	b.buf <<= n
+	b.nbits -= n
+}
+
+func (b *bitReader) read(n uint) uint32 {
+	v := b.peek(n)
+	b.remove(n)
+	return v
+}
+
+// unary counts the zeros before the next one bit and skips both
+func (b *bitReader) unary() uint32 {
+	var n uint32
+	for !b.overflow() {
+		if b.nbits == 0 {
+			b.fill()
+		}
+		zeros := uint(bits.LeadingZeros64(b.buf))
+		if zeros < b.nbits {
+			b.remove(zeros + 1)
+			return n + uint32(zeros)
+		}
+		n += uint32(b.nbits)
+		b.buf = 0
+		b.nbits = 0
+	}
+	return n
+}
+
+// align skips to the next byte boundary
+func (b *bitReader) align() {
+	b.remove(b.nbits % 8)
+}
+
+// consumed is the number of whole bytes read so far
+func (b *bitReader) consumed() int {
+	return (b.off*8 - int(b.nbits)) / 8
+}
+
+func (b *bitReader) overflow() bool {
+	return b.off*8-int(b.nbits) > len(b.data)*8
+}
+
+var errHuffman = errors.New("invalid huffman tree")
+
+// huffman decodes MAME's canonical huffman codes, longer codes get the lower
+// code numbers.
+type huffman struct {
+	maxbits uint
+	numbits []uint8
+	// lookup maps the next maxbits bits to code<<5 | code length
+	lookup []uint32
+}
+
+func newHuffman(numcodes int, maxbits uint) *huffman {
+	return &huffman{maxbits: maxbits, numbits: make([]uint8, numcodes)}
+}
+
+// importTreeRLE reads the code lengths as stored before a compressed map
+func (h *huffman) importTreeRLE(b *bitReader) error {
+	var width uint = 3
+	if h.maxbits >= 16 {
+		width = 5
+	} else if h.maxbits >= 8 {
+		width = 4
+	}
+
+	code := 0
+	for code < len(h.numbits) {
+		n := b.read(width)
+		if n != 1 {
+			h.numbits[code] = uint8(n)
+			code++
+			continue
+		}
+		// a one is an escape, two ones are a single one
+		n = b.read(width)
+		if n == 1 {
+			h.numbits[code] = 1
+			code++
+			continue
+		}
+		repeat := int(b.read(width)) + 3
+		if code+repeat > len(h.numbits) {
+			return errHuffman
+		}
+		for ; repeat > 0; repeat-- {
+			h.numbits[code] = uint8(n)
+			code++
+		}
+	}
+	if b.overflow() {
+		return errHuffman
+	}
+	return h.build()
+}
+
+// build assigns the canonical codes and fills the lookup table
+func (h *huffman) build() error {
+	var histo [33]uint32
+	for _, n := range h.numbits {
+		if uint(n) > h.maxbits {
+			return errHuffman
+		}
+		histo[n]++
+	}
+	var start uint32
+	for length := 32; length > 0; length-- {
+		next := (start + histo[length]) >> 1
+		if length != 1 && next*2 != start+histo[length] {
+			return errHuffman
+		}
+		histo[length] = start
+		start = next
+	}
+
+	h.lookup = make([]uint32, 1<<h.maxbits)
+	for code, n := range h.numbits {
+		if n == 0 {
+			continue
+		}
+		shift := h.maxbits - uint(n)
+		first := histo[n] << shift
+		histo[n]++
+		last := first + 1<<shift
+		if last > uint32(len(h.lookup)) {
+			return errHuffman
+		}
+		for i := first; i < last; i++ {
+			h.lookup[i] = uint32(code)<<5 | uint32(n)
+		}
+	}
+	return nil
+}
+
+func (h *huffman) decode(b *bitReader) uint32 {
+	v := h.lookup[b.peek(h.maxbits)]
+	b.remove(uint(v & 0x1f))
+	return v >> 5
+}
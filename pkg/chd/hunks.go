@@ -0,0 +1,295 @@
+package chd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Map entry types of a compressed v5 map, the pseudo types are only used in
+// the stored map and are resolved to self and parent while decoding it
+const (
+	compressionType0 = iota
+	compressionType1
+	compressionType2
+	compressionType3
+	compressionNone
+	compressionSelf
+	compressionParent
+	compressionRLESmall
+	compressionRLELarge
+	compressionSelf0
+	compressionSelf1
+	compressionParentSelf
+	compressionParent0
+	compressionParent1
+)
+
+// mapEntrySize is the size of a decoded map entry: type, 24 bit length, 48
+// bit offset and CRC16
+const mapEntrySize = 12
+
+// Hunks reads the decompressed hunks of a CHD. CHDs that need a parent can't
+// be read.
+type Hunks struct {
+	r      io.ReaderAt
+	header Header
+	count  uint32
+	// rawMap holds mapEntrySize bytes per hunk, or 4 byte offsets in hunks
+	// for uncompressed CHDs
+	rawMap []byte
+	codecs [4]decompressor
+}
+
+func NewHunks(r io.ReaderAt, header Header) (*Hunks, error) {
+	if header.HunkBytes == 0 {
+		return nil, errors.New("hunk size is 0")
+	}
+	h := &Hunks{
+		r:      r,
+		header: header,
+		count:  uint32((header.LogicalBytes + uint64(header.HunkBytes) - 1) / uint64(header.HunkBytes)),
+	}
+	if header.Compressors[0] == "" {
+		h.rawMap = make([]byte, int(h.count)*4)
+		err := h.readAt(h.rawMap, header.MapOffset)
+		if err != nil {
+			return nil, fmt.Errorf("reading map: %w", err)
+		}
+		return h, nil
+	}
+
+	for i, tag := range header.Compressors {
+		if tag == "" {
+			continue
+		}
+		codec, err := newDecompressor(tag)
+		if err != nil {
+			return nil, err
+		}
+		h.codecs[i] = codec
+	}
+	err := h.readMap()
+	if err != nil {
+		return nil, fmt.Errorf("reading map: %w", err)
+	}
+	return h, nil
+}
+
+func (h *Hunks) Count() uint32 {
+	return h.count
+}
+
+// readMap decodes a compressed v5 map: huffman coded entry types with run
+// lengths, then the length, offset and CRC of every entry.
+func (h *Hunks) readMap() error {
+	head := make([]byte, 16)
+	err := h.readAt(head, h.header.MapOffset)
+	if err != nil {
+		return err
+	}
+	mapBytes := binary.BigEndian.Uint32(head[0:])
+	offset := uint64(binary.BigEndian.Uint16(head[4:]))<<32 | uint64(binary.BigEndian.Uint32(head[6:]))
+	mapCRC := binary.BigEndian.Uint16(head[10:])
+	lengthBits := uint(head[12])
+	selfBits := uint(head[13])
+	parentBits := uint(head[14])
+	if lengthBits > 32 || selfBits > 32 || parentBits > 32 {
+		return errors.New("invalid map header")
+	}
+
+	// the map is at most a few bytes per hunk
+	if uint64(mapBytes) > uint64(h.count)*16+1024 {
+		return fmt.Errorf("map size %v too large for %v hunks", mapBytes, h.count)
+	}
+	data := make([]byte, mapBytes)
+	err = h.readAt(data, h.header.MapOffset+16)
+	if err != nil {
+		return err
+	}
+	b := newBitReader(data)
+
+	types := newHuffman(16, 8)
+	err = types.importTreeRLE(b)
+	if err != nil {
+		return err
+	}
+	h.rawMap = make([]byte, int(h.count)*mapEntrySize)
+	var last uint8
+	repeat := 0
+	for n := range h.count {
+		entry := h.rawMap[n*mapEntrySize:]
+		if repeat > 0 {
+			entry[0] = last
+			repeat--
+			continue
+		}
+		switch v := types.decode(b); v {
+		case compressionRLESmall:
+			entry[0] = last
+			repeat = 2 + int(types.decode(b))
+		case compressionRLELarge:
+			entry[0] = last
+			repeat = 2 + 16 + int(types.decode(b))<<4
+			repeat += int(types.decode(b))
+		default:
+			last = uint8(v)
+			entry[0] = last
+		}
+	}
+
+	var lastSelf, lastParent uint64
+	unitBytes := uint64(h.header.UnitBytes)
+	if unitBytes == 0 {
+		unitBytes = 1
+	}
+	for n := range h.count {
+		entry := h.rawMap[n*mapEntrySize:]
+		entryOffset := offset
+		var length uint32
+		var crc uint16
+		switch entry[0] {
+		case compressionType0, compressionType1, compressionType2, compressionType3:
+			length = b.read(lengthBits)
+			offset += uint64(length)
+			crc = uint16(b.read(16))
+		case compressionNone:
+			length = h.header.HunkBytes
+			offset += uint64(length)
+			crc = uint16(b.read(16))
+		case compressionSelf:
+			lastSelf = uint64(b.read(selfBits))
+			entryOffset = lastSelf
+		case compressionParent:
+			lastParent = uint64(b.read(parentBits))
+			entryOffset = lastParent
+		case compressionSelf0, compressionSelf1:
+			if entry[0] == compressionSelf1 {
+				lastSelf++
+			}
+			entry[0] = compressionSelf
+			entryOffset = lastSelf
+		case compressionParentSelf:
+			entry[0] = compressionParent
+			lastParent = uint64(n) * uint64(h.header.HunkBytes) / unitBytes
+			entryOffset = lastParent
+		case compressionParent0, compressionParent1:
+			if entry[0] == compressionParent1 {
+				lastParent += uint64(h.header.HunkBytes) / unitBytes
+			}
+			entry[0] = compressionParent
+			entryOffset = lastParent
+		default:
+			return fmt.Errorf("invalid map entry type %v", entry[0])
+		}
+		entry[1] = byte(length >> 16)
+		entry[2] = byte(length >> 8)
+		entry[3] = byte(length)
+		binary.BigEndian.PutUint16(entry[4:], uint16(entryOffset>>32))
+		binary.BigEndian.PutUint32(entry[6:], uint32(entryOffset))
+		binary.BigEndian.PutUint16(entry[10:], crc)
+	}
+	if b.overflow() {
+		return io.ErrUnexpectedEOF
+	}
+	if crc16(h.rawMap) != mapCRC {
+		return errors.New("map CRC mismatch")
+	}
+	return nil
+}
+
+// Read decompresses hunk n into dest, which must be HunkBytes long
+func (h *Hunks) Read(n uint32, dest []byte) error {
+	if n >= h.count {
+		return fmt.Errorf("hunk %v out of range", n)
+	}
+	if len(dest) != int(h.header.HunkBytes) {
+		return fmt.Errorf("hunk buffer is %v bytes, want %v", len(dest), h.header.HunkBytes)
+	}
+
+	if h.header.Compressors[0] == "" {
+		offset := uint64(binary.BigEndian.Uint32(h.rawMap[n*4:])) * uint64(h.header.HunkBytes)
+		if offset == 0 {
+			clear(dest)
+			return nil
+		}
+		return h.readAt(dest, offset)
+	}
+
+	entry := h.rawMap[n*mapEntrySize:]
+	length := uint32(entry[1])<<16 | uint32(entry[2])<<8 | uint32(entry[3])
+	offset := uint64(binary.BigEndian.Uint16(entry[4:]))<<32 | uint64(binary.BigEndian.Uint32(entry[6:]))
+	crc := binary.BigEndian.Uint16(entry[10:])
+	switch entry[0] {
+	case compressionType0, compressionType1, compressionType2, compressionType3:
+		codec := h.codecs[entry[0]]
+		if codec == nil {
+			return fmt.Errorf("hunk %v uses unset compressor %v", n, entry[0])
+		}
+		src := make([]byte, length)
+		err := h.readAt(src, offset)
+		if err != nil {
+			return err
+		}
+		err = codec.decompress(src, dest)
+		if err != nil {
+			return fmt.Errorf("hunk %v: %w", n, err)
+		}
+	case compressionNone:
+		err := h.readAt(dest, offset)
+		if err != nil {
+			return err
+		}
+	case compressionSelf:
+		// copies always refer to an earlier hunk
+		if offset >= uint64(n) {
+			return fmt.Errorf("hunk %v copies hunk %v", n, offset)
+		}
+		return h.Read(uint32(offset), dest)
+	case compressionParent:
+		return fmt.Errorf("hunk %v is stored in the parent CHD", n)
+	}
+	if crc16(dest) != crc {
+		return fmt.Errorf("hunk %v CRC mismatch", n)
+	}
+	return nil
+}
+
+// readAt reads all of p, data cut short by the end of the file is an error
+// rather than the end of a track
+func (h *Hunks) readAt(p []byte, offset uint64) error {
+	n, err := h.r.ReadAt(p, int64(offset))
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc16 is the CRC-16/CCITT used by CHD maps and hunks
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, c := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^c]
+	}
+	return crc
+}
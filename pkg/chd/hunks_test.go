@@ -0,0 +1,274 @@
+package chd
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// bitWriter writes MSB first bit fields, the inverse of bitReader
+type bitWriter struct {
+	data  []byte
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.nbits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.data[len(w.data)-1] |= 0x80 >> (w.nbits % 8)
+		}
+		w.nbits++
+	}
+}
+
+func (w *bitWriter) align() {
+	w.nbits = (w.nbits + 7) / 8 * 8
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	fw.Close()
+	return buf.Bytes()
+}
+
+// mode1Sector is a MODE1 sector with its sync, header and ECC
+func mode1Sector(lba int, fill byte) []byte {
+	s := make([]byte, cdFrameSize)
+	copy(s, cdSync)
+	s[12], s[13], s[14], s[15] = 0, 2, byte(lba), 1
+	for i := 16; i < 16+2048; i++ {
+		s[i] = fill + byte(i)
+	}
+	eccGenerate(s)
+	return s
+}
+
+// audioFrame is a frame of little-endian samples as in a BIN file
+func audioFrame(fill byte) []byte {
+	s := make([]byte, cdFrameSize)
+	for i := range s {
+		s[i] = fill * byte(i)
+	}
+	return s
+}
+
+// swapped is audio as stored in a CHD
+func swapped(frame []byte) []byte {
+	s := bytes.Clone(frame)
+	for i := 0; i < len(s); i += 2 {
+		s[i], s[i+1] = s[i+1], s[i]
+	}
+	return s
+}
+
+// encodeVerbatimFLAC encodes big-endian stereo samples as a single frame of
+// verbatim subframes
+func encodeVerbatimFLAC(data []byte) []byte {
+	samples := len(data) / 4
+	w := &bitWriter{}
+	w.write(0x3ffe, 14)
+	w.write(0, 2)
+	w.write(7, 4)
+	w.write(9, 4)
+	w.write(1, 4)
+	w.write(4, 3)
+	w.write(0, 1)
+	w.write(0, 8)
+	w.write(uint32(samples-1), 16)
+	w.write(0, 8)
+	for ch := range 2 {
+		w.write(0, 1)
+		w.write(1, 6)
+		w.write(0, 1)
+		for i := range samples {
+			w.write(uint32(binary.BigEndian.Uint16(data[i*4+ch*2:])), 16)
+		}
+	}
+	w.align()
+	w.write(0, 16)
+	return w.data
+}
+
+// testCHD builds a CD CHD with a 5 frame MODE1 track and a 3 frame audio
+// track in 3 hunks of 4 frames: a cdzl hunk with regenerated ECC, an
+// uncompressed hunk and a cdfl hunk.
+func testCHD(t *testing.T) ([]byte, []byte, []byte) {
+	t.Helper()
+	const unitsPerHunk = 4
+	hunkBytes := unitsPerHunk * cdUnitSize
+
+	data := make([][]byte, 0)
+	for i := range 5 {
+		data = append(data, mode1Sector(i, byte(i)))
+	}
+	data = append(data, make([]byte, cdFrameSize), make([]byte, cdFrameSize), make([]byte, cdFrameSize))
+	audio := make([]byte, 0)
+	for i := range 3 {
+		frame := audioFrame(byte(i + 1))
+		audio = append(audio, frame...)
+		data = append(data, swapped(frame))
+	}
+	data = append(data, make([]byte, cdFrameSize))
+	track1 := bytes.Join(data[:5], nil)
+
+	hunks := make([][]byte, 3)
+	for n := range hunks {
+		hunk := make([]byte, 0, hunkBytes)
+		for _, frame := range data[n*unitsPerHunk : (n+1)*unitsPerHunk] {
+			hunk = append(hunk, frame...)
+			hunk = append(hunk, make([]byte, cdSubcodeSize)...)
+		}
+		hunks[n] = hunk
+	}
+
+	// cdzl with the sync and ECC of every frame removed
+	sectors := bytes.Join(data[:unitsPerHunk], nil)
+	for n := range unitsPerHunk {
+		s := sectors[n*cdFrameSize:]
+		clear(s[:len(cdSync)])
+		clear(s[eccPOffset:cdFrameSize])
+	}
+	base := deflate(t, sectors)
+	hunk0 := []byte{0x0f, byte(len(base) >> 8), byte(len(base))}
+	hunk0 = append(hunk0, base...)
+	hunk0 = append(hunk0, deflate(t, make([]byte, unitsPerHunk*cdSubcodeSize))...)
+
+	// cdfl
+	hunk2 := encodeVerbatimFLAC(bytes.Join(data[8:12], nil))
+	hunk2 = append(hunk2, deflate(t, make([]byte, unitsPerHunk*cdSubcodeSize))...)
+
+	meta := make([]byte, 0)
+	metaOffset := 124
+	tracks := []string{
+		"TRACK:1 TYPE:MODE1_RAW SUBTYPE:NONE FRAMES:5 PREGAP:0 PGTYPE:MODE1 PGSUB:RW POSTGAP:0",
+		"TRACK:2 TYPE:AUDIO SUBTYPE:NONE FRAMES:3 PREGAP:0 PGTYPE:AUDIO PGSUB:RW POSTGAP:0",
+	}
+	for i, text := range tracks {
+		entry := make([]byte, metaHeaderLen)
+		copy(entry, TagCDTrack2)
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(text)+1))
+		if i < len(tracks)-1 {
+			next := metaOffset + len(meta) + metaHeaderLen + len(text) + 1
+			binary.BigEndian.PutUint64(entry[8:], uint64(next))
+		}
+		meta = append(meta, entry...)
+		meta = append(meta, text...)
+		meta = append(meta, 0)
+	}
+
+	// map: type 0 is "1", type 1 "00" and none "01"
+	mapOffset := metaOffset + len(meta)
+	w := &bitWriter{}
+	for _, v := range []uint32{1, 1, 2, 0, 0, 2, 1, 0, 8} {
+		w.write(v, 4)
+	}
+	w.write(1, 1)
+	w.write(1, 2)
+	w.write(0, 2)
+	w.write(uint32(len(hunk0)), 16)
+	w.write(uint32(crc16(hunks[0])), 16)
+	w.write(uint32(crc16(hunks[1])), 16)
+	w.write(uint32(len(hunk2)), 16)
+	w.write(uint32(crc16(hunks[2])), 16)
+	mapData := w.data
+
+	first := uint64(mapOffset + 16 + len(mapData))
+	raw := make([]byte, 0)
+	offset := first
+	for n, length := range []int{len(hunk0), hunkBytes, len(hunk2)} {
+		entry := make([]byte, mapEntrySize)
+		entry[0] = []byte{compressionType0, compressionNone, compressionType1}[n]
+		entry[1], entry[2], entry[3] = byte(length>>16), byte(length>>8), byte(length)
+		binary.BigEndian.PutUint16(entry[4:], uint16(offset>>32))
+		binary.BigEndian.PutUint32(entry[6:], uint32(offset))
+		binary.BigEndian.PutUint16(entry[10:], crc16(hunks[n]))
+		raw = append(raw, entry...)
+		offset += uint64(length)
+	}
+	mapHead := make([]byte, 16)
+	binary.BigEndian.PutUint32(mapHead[0:], uint32(len(mapData)))
+	binary.BigEndian.PutUint16(mapHead[4:], uint16(first>>32))
+	binary.BigEndian.PutUint32(mapHead[6:], uint32(first))
+	binary.BigEndian.PutUint16(mapHead[10:], crc16(raw))
+	mapHead[12] = 16
+
+	header := make([]byte, chdV5Length)
+	copy(header, chdMagic)
+	binary.BigEndian.PutUint32(header[8:], chdV5Length)
+	binary.BigEndian.PutUint32(header[12:], 5)
+	copy(header[16:], CodecCDZlib)
+	copy(header[20:], CodecCDFLAC)
+	binary.BigEndian.PutUint64(header[32:], uint64(3*hunkBytes))
+	binary.BigEndian.PutUint64(header[40:], uint64(mapOffset))
+	binary.BigEndian.PutUint64(header[48:], uint64(metaOffset))
+	binary.BigEndian.PutUint32(header[56:], uint32(hunkBytes))
+	binary.BigEndian.PutUint32(header[60:], cdUnitSize)
+
+	file := bytes.Join([][]byte{header, meta, mapHead, mapData, hunk0, hunks[1], hunk2}, nil)
+	return file, track1, audio
+}
+
+func TestTrackReader(t *testing.T) {
+	file, track1, track2 := testCHD(t)
+	r := bytes.NewReader(file)
+	c, err := Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Tracks) != 2 {
+		t.Fatalf("read %v tracks, want 2", len(c.Tracks))
+	}
+	hunks, err := NewHunks(r, c.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]byte{track1, track2} {
+		tr, err := c.TrackReader(hunks, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("track %v: %v", i+1, err)
+		}
+		if int64(len(got)) != c.Tracks[i].Size() {
+			t.Errorf("track %v is %v bytes, want %v", i+1, len(got), c.Tracks[i].Size())
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("track %v data differs", i+1)
+		}
+	}
+}
+
+func TestHunksCorrupt(t *testing.T) {
+	file, _, _ := testCHD(t)
+	c, err := Read(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip a byte of the uncompressed hunk, it starts with frame 5
+	corrupt := bytes.Clone(file)
+	corrupt[bytes.Index(file, mode1Sector(4, 4))+100] ^= 0xff
+	hunks, err := NewHunks(bytes.NewReader(corrupt), c.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := make([]byte, c.Header.HunkBytes)
+	for n := range hunks.Count() {
+		err = hunks.Read(n, dest)
+		if (err != nil) != (n == 1) {
+			t.Errorf("hunk %v: Read = %v", n, err)
+		}
+	}
+}
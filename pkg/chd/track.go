@@ -0,0 +1,89 @@
+package chd
+
+import (
+	"errors"
+	"io"
+)
+
+// cdTrackPadding pads every track to a multiple of 4 frames in the CHD
+const cdTrackPadding = 4
+
+// IsAudio reports whether the track's samples are stored byte swapped
+func (t Track) IsAudio() bool {
+	return t.Type == "AUDIO"
+}
+
+// TrackReader reads track i as it is in a raw BIN file: 2352 byte frames
+// without subcode, audio samples little-endian and the Size pregap frames
+// that aren't stored in the CHD as zeros.
+func (c CHD) TrackReader(hunks *Hunks, i int) (io.Reader, error) {
+	if c.Header.HunkBytes == 0 || c.Header.HunkBytes%cdUnitSize != 0 {
+		return nil, errors.New("not a CD CHD")
+	}
+	if i < 0 || i >= len(c.Tracks) {
+		return nil, errors.New("track out of range")
+	}
+	var start int64
+	for _, t := range c.Tracks[:i] {
+		start += int64((t.Frames + cdTrackPadding - 1) / cdTrackPadding * cdTrackPadding)
+	}
+	t := c.Tracks[i]
+	return &trackReader{
+		hunks:        hunks,
+		unitsPerHunk: int64(c.Header.HunkBytes / cdUnitSize),
+		zeros:        t.Size() - int64(t.Frames)*cdFrameSize,
+		frame:        start,
+		end:          start + int64(t.Frames),
+		audio:        t.IsAudio(),
+		hunkNum:      -1,
+	}, nil
+}
+
+type trackReader struct {
+	hunks        *Hunks
+	unitsPerHunk int64
+	zeros        int64
+	frame, end   int64
+	audio        bool
+	hunk         []byte
+	hunkNum      int64
+	sector       [cdFrameSize]byte
+	buf          []byte
+}
+
+func (t *trackReader) Read(p []byte) (int, error) {
+	if t.zeros > 0 {
+		n := int(min(int64(len(p)), t.zeros))
+		clear(p[:n])
+		t.zeros -= int64(n)
+		return n, nil
+	}
+	if len(t.buf) == 0 {
+		if t.frame >= t.end {
+			return 0, io.EOF
+		}
+		num := t.frame / t.unitsPerHunk
+		if num != t.hunkNum {
+			if t.hunk == nil {
+				t.hunk = make([]byte, t.hunks.header.HunkBytes)
+			}
+			err := t.hunks.Read(uint32(num), t.hunk)
+			if err != nil {
+				return 0, err
+			}
+			t.hunkNum = num
+		}
+		offset := (t.frame % t.unitsPerHunk) * cdUnitSize
+		copy(t.sector[:], t.hunk[offset:offset+cdFrameSize])
+		if t.audio {
+			for i := 0; i < cdFrameSize; i += 2 {
+				t.sector[i], t.sector[i+1] = t.sector[i+1], t.sector[i]
+			}
+		}
+		t.buf = t.sector[:]
+		t.frame++
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
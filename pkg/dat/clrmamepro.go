@@ -0,0 +1,169 @@
+package dat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+clrmamepro DATs are nested blocks of key/value pairs:
+
+	clrmamepro (
+		name "Nintendo - Game Boy"
+	)
+	game (
+		name "Tetris (World)"
+		rom ( name "Tetris (World).gb" size 32768 crc 46DF91AD )
+	)
+*/
+
+type cmpToken struct {
+	Value  string
+	Quoted bool
+}
+
+type cmpBlock struct {
+	Values map[string]string
+	Blocks map[string][]cmpBlock
+}
+
+func ParseClrMamePro(r io.Reader) (DatFile, error) {
+	df := DatFile{Games: make([]DatGame, 0)}
+	tokens, err := tokenizeClrMamePro(r)
+	if err != nil {
+		return df, err
+	}
+
+	pos := 0
+	for pos < len(tokens) {
+		name := tokens[pos].Value
+		if pos+1 >= len(tokens) || tokens[pos+1].Value != "(" || tokens[pos+1].Quoted {
+			return df, fmt.Errorf("expected block after %q", name)
+		}
+		block, next, err := parseClrMameProBlock(tokens, pos+2)
+		if err != nil {
+			return df, err
+		}
+		pos = next
+
+		switch name {
+		case "clrmamepro":
+			df.Header = DatHeader{
+				Name:        block.Values["name"],
+				Description: block.Values["description"],
+				Version:     block.Values["version"],
+				Date:        block.Values["date"],
+				Author:      block.Values["author"],
+				Homepage:    block.Values["homepage"],
+				URL:         block.Values["url"],
+			}
+		case "game", "machine", "resource":
+			game := DatGame{
+				Name:         block.Values["name"],
+				Description:  block.Values["description"],
+				CloneOf:      block.Values["cloneof"],
+				RomOf:        block.Values["romof"],
+				Year:         block.Values["year"],
+				Manufacturer: block.Values["manufacturer"],
+				Serial:       block.Values["serial"],
+				Roms:         make([]DatRom, 0),
+			}
+			for _, rb := range block.Blocks["rom"] {
+				size, _ := strconv.Atoi(rb.Values["size"])
+				game.Roms = append(game.Roms, DatRom{
+					Name:   rb.Values["name"],
+					Size:   size,
+					CRC:    rb.Values["crc"],
+					MD5:    rb.Values["md5"],
+					SHA1:   rb.Values["sha1"],
+					Serial: rb.Values["serial"],
+					Status: rb.Values["flags"],
+				})
+			}
+			df.Games = append(df.Games, game)
+		}
+	}
+	return df, nil
+}
+
+func parseClrMameProBlock(tokens []cmpToken, pos int) (cmpBlock, int, error) {
+	block := cmpBlock{
+		Values: make(map[string]string),
+		Blocks: make(map[string][]cmpBlock),
+	}
+	for pos < len(tokens) {
+		tok := tokens[pos]
+		if tok.Value == ")" && !tok.Quoted {
+			return block, pos + 1, nil
+		}
+		if pos+1 >= len(tokens) {
+			break
+		}
+		key := tok.Value
+		next := tokens[pos+1]
+		if next.Value == "(" && !next.Quoted {
+			child, end, err := parseClrMameProBlock(tokens, pos+2)
+			if err != nil {
+				return block, end, err
+			}
+			block.Blocks[key] = append(block.Blocks[key], child)
+			pos = end
+			continue
+		}
+		if _, ok := block.Values[key]; !ok {
+			block.Values[key] = next.Value
+		}
+		pos += 2
+	}
+	return block, pos, errors.New("unterminated block")
+}
+
+func tokenizeClrMamePro(r io.Reader) ([]cmpToken, error) {
+	tokens := make([]cmpToken, 0)
+	br := bufio.NewReader(r)
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, cmpToken{Value: sb.String()})
+			sb.Reset()
+		}
+	}
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			flush()
+			return tokens, nil
+		} else if err != nil {
+			return tokens, err
+		}
+
+		switch {
+		case c == '"':
+			flush()
+			for {
+				c, _, err = br.ReadRune()
+				if err != nil {
+					return tokens, errors.New("unterminated string")
+				}
+				if c == '"' {
+					break
+				}
+				sb.WriteRune(c)
+			}
+			tokens = append(tokens, cmpToken{Value: sb.String(), Quoted: true})
+			sb.Reset()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, cmpToken{Value: string(c)})
+		case unicode.IsSpace(c) || c == '\ufeff':
+			flush()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+}
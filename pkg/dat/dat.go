@@ -0,0 +1,102 @@
+package dat
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+)
+
+type DatHeader struct {
+	Name        string
+	Description string
+	Version     string
+	Date        string
+	Author      string
+	Homepage    string
+	URL         string
+}
+
+type DatRom struct {
+	Name   string
+	Size   int
+	CRC    string
+	MD5    string
+	SHA1   string
+	Serial string
+	Status string
+}
+
+type DatGame struct {
+	Name         string
+	Description  string
+	CloneOf      string
+	RomOf        string
+	Year         string
+	Manufacturer string
+	Serial       string
+	Roms         []DatRom
+}
+
+type DatFile struct {
+	Header DatHeader
+	Games  []DatGame
+}
+
+// LoadDAT parses a Logiqx XML or clrmamepro text DAT, the format is detected
+// from the first non whitespace byte.
+func LoadDAT(datPath string) (DatFile, error) {
+	f, err := os.Open(datPath)
+	if err != nil {
+		return DatFile{}, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	peek, _ := br.Peek(512)
+	peek = bytes.TrimLeft(peek, "\xef\xbb\xbf \t\r\n")
+	var df DatFile
+	if bytes.HasPrefix(peek, []byte("<")) {
+		df, err = ParseLogiqx(br)
+	} else {
+		df, err = ParseClrMamePro(br)
+	}
+	if err != nil {
+		return df, fmt.Errorf("%v: %w", datPath, err)
+	}
+	return df, nil
+}
+
+// ROMs flattens the DAT into one RdbJsonROM per rom entry, the same shape
+// libretro RDBs use for multi file games.
+func (df DatFile) ROMs(rdbName string) []rdb.RdbJsonROM {
+	roms := make([]rdb.RdbJsonROM, 0, len(df.Games))
+	for _, game := range df.Games {
+		for _, rom := range game.Roms {
+			serial := rom.Serial
+			if serial == "" {
+				serial = game.Serial
+			}
+			description := game.Description
+			if description == game.Name {
+				description = ""
+			}
+			roms = append(roms, rdb.RdbJsonROM{
+				Serial:      rdb.EncodeSerial(serial),
+				MD5:         strings.ToUpper(rom.MD5),
+				SHA1:        strings.ToUpper(rom.SHA1),
+				CRC:         strings.ToUpper(rom.CRC),
+				Size:        rom.Size,
+				RomName:     rom.Name,
+				Description: description,
+				Name:        game.Name,
+				RDBName:     rdbName,
+				CloneOf:     game.CloneOf,
+			})
+		}
+	}
+	return roms
+}
@@ -0,0 +1,93 @@
+package dat
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type logiqxRom struct {
+	Name   string `xml:"name,attr"`
+	Size   string `xml:"size,attr"`
+	CRC    string `xml:"crc,attr"`
+	MD5    string `xml:"md5,attr"`
+	SHA1   string `xml:"sha1,attr"`
+	Serial string `xml:"serial,attr"`
+	Status string `xml:"status,attr"`
+}
+
+type logiqxGame struct {
+	Name         string      `xml:"name,attr"`
+	CloneOf      string      `xml:"cloneof,attr"`
+	RomOf        string      `xml:"romof,attr"`
+	Description  string      `xml:"description"`
+	Year         string      `xml:"year"`
+	Manufacturer string      `xml:"manufacturer"`
+	Serial       string      `xml:"serial"`
+	Roms         []logiqxRom `xml:"rom"`
+}
+
+type logiqxDat struct {
+	Header struct {
+		Name        string `xml:"name"`
+		Description string `xml:"description"`
+		Version     string `xml:"version"`
+		Date        string `xml:"date"`
+		Author      string `xml:"author"`
+		Homepage    string `xml:"homepage"`
+		URL         string `xml:"url"`
+	} `xml:"header"`
+	Games    []logiqxGame `xml:"game"`
+	Machines []logiqxGame `xml:"machine"`
+}
+
+func ParseLogiqx(r io.Reader) (DatFile, error) {
+	var ld logiqxDat
+	dec := xml.NewDecoder(r)
+	// Logiqx DTD references are common, entities beyond the XML defaults aren't
+	dec.Strict = false
+	err := dec.Decode(&ld)
+	if err != nil {
+		return DatFile{}, err
+	}
+
+	df := DatFile{
+		Header: DatHeader{
+			Name:        strings.TrimSpace(ld.Header.Name),
+			Description: strings.TrimSpace(ld.Header.Description),
+			Version:     strings.TrimSpace(ld.Header.Version),
+			Date:        strings.TrimSpace(ld.Header.Date),
+			Author:      strings.TrimSpace(ld.Header.Author),
+			Homepage:    strings.TrimSpace(ld.Header.Homepage),
+			URL:         strings.TrimSpace(ld.Header.URL),
+		},
+		Games: make([]DatGame, 0, len(ld.Games)+len(ld.Machines)),
+	}
+	for _, lg := range append(ld.Games, ld.Machines...) {
+		game := DatGame{
+			Name:         lg.Name,
+			Description:  strings.TrimSpace(lg.Description),
+			CloneOf:      lg.CloneOf,
+			RomOf:        lg.RomOf,
+			Year:         strings.TrimSpace(lg.Year),
+			Manufacturer: strings.TrimSpace(lg.Manufacturer),
+			Serial:       strings.TrimSpace(lg.Serial),
+			Roms:         make([]DatRom, 0, len(lg.Roms)),
+		}
+		for _, lr := range lg.Roms {
+			size, _ := strconv.Atoi(lr.Size)
+			game.Roms = append(game.Roms, DatRom{
+				Name:   lr.Name,
+				Size:   size,
+				CRC:    lr.CRC,
+				MD5:    lr.MD5,
+				SHA1:   lr.SHA1,
+				Serial: lr.Serial,
+				Status: lr.Status,
+			})
+		}
+		df.Games = append(df.Games, game)
+	}
+	return df, nil
+}
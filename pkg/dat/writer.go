@@ -0,0 +1,104 @@
+package dat
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+const logiqxDoctype = `<!DOCTYPE datafile PUBLIC "-//Logiqx//DTD ROM Management Datafile//EN" "http://www.logiqx.com/Dats/datafile.dtd">`
+
+type logiqxRomOut struct {
+	Name   string `xml:"name,attr"`
+	Size   string `xml:"size,attr,omitempty"`
+	CRC    string `xml:"crc,attr,omitempty"`
+	MD5    string `xml:"md5,attr,omitempty"`
+	SHA1   string `xml:"sha1,attr,omitempty"`
+	Serial string `xml:"serial,attr,omitempty"`
+	Status string `xml:"status,attr,omitempty"`
+}
+
+type logiqxGameOut struct {
+	Name         string         `xml:"name,attr"`
+	CloneOf      string         `xml:"cloneof,attr,omitempty"`
+	RomOf        string         `xml:"romof,attr,omitempty"`
+	Description  string         `xml:"description"`
+	Year         string         `xml:"year,omitempty"`
+	Manufacturer string         `xml:"manufacturer,omitempty"`
+	Roms         []logiqxRomOut `xml:"rom"`
+}
+
+type logiqxHeaderOut struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Version     string `xml:"version,omitempty"`
+	Date        string `xml:"date,omitempty"`
+	Author      string `xml:"author,omitempty"`
+	Homepage    string `xml:"homepage,omitempty"`
+	URL         string `xml:"url,omitempty"`
+}
+
+type logiqxDatOut struct {
+	XMLName xml.Name        `xml:"datafile"`
+	Header  logiqxHeaderOut `xml:"header"`
+	Games   []logiqxGameOut `xml:"game"`
+}
+
+func WriteLogiqx(w io.Writer, df DatFile) error {
+	out := logiqxDatOut{
+		Header: logiqxHeaderOut{
+			Name:        df.Header.Name,
+			Description: df.Header.Description,
+			Version:     df.Header.Version,
+			Date:        df.Header.Date,
+			Author:      df.Header.Author,
+			Homepage:    df.Header.Homepage,
+			URL:         df.Header.URL,
+		},
+		Games: make([]logiqxGameOut, 0, len(df.Games)),
+	}
+	for _, game := range df.Games {
+		description := game.Description
+		if description == "" {
+			description = game.Name
+		}
+		lg := logiqxGameOut{
+			Name:         game.Name,
+			CloneOf:      game.CloneOf,
+			RomOf:        game.RomOf,
+			Description:  description,
+			Year:         game.Year,
+			Manufacturer: game.Manufacturer,
+			Roms:         make([]logiqxRomOut, 0, len(game.Roms)),
+		}
+		for _, rom := range game.Roms {
+			size := ""
+			if rom.Size > 0 {
+				size = strconv.Itoa(rom.Size)
+			}
+			lg.Roms = append(lg.Roms, logiqxRomOut{
+				Name:   rom.Name,
+				Size:   size,
+				CRC:    rom.CRC,
+				MD5:    rom.MD5,
+				SHA1:   rom.SHA1,
+				Serial: rom.Serial,
+				Status: rom.Status,
+			})
+		}
+		out.Games = append(out.Games, lg)
+	}
+
+	_, err := io.WriteString(w, xml.Header+logiqxDoctype+"\n")
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	err = enc.Encode(out)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
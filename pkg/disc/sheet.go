@@ -0,0 +1,189 @@
+package disc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+Parses .cue and .gdi sheets into the list of track files they reference.
+Paths are resolved relative to the sheet, the files themselves aren't opened.
+*/
+
+type Track struct {
+	Number int
+	// Type is the cue track mode (MODE1/2352, AUDIO, ...) or the GDI type
+	// (0 audio, 4 data)
+	Type string
+	Data bool
+	Path string
+}
+
+type Sheet struct {
+	Path   string
+	Tracks []Track
+}
+
+func IsSheet(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cue", ".gdi":
+		return true
+	}
+	return false
+}
+
+// Files lists each referenced file once, in track order. A cue sheet may put
+// several tracks in a single file.
+func (s Sheet) Files() []Track {
+	files := make([]Track, 0, len(s.Tracks))
+	seen := make(map[string]bool)
+	for _, t := range s.Tracks {
+		if seen[t.Path] {
+			continue
+		}
+		seen[t.Path] = true
+		files = append(files, t)
+	}
+	return files
+}
+
+// DataFiles lists each file holding at least one data track, in track order
+func (s Sheet) DataFiles() []string {
+	files := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range s.Tracks {
+		if !t.Data || seen[t.Path] {
+			continue
+		}
+		seen[t.Path] = true
+		files = append(files, t.Path)
+	}
+	return files
+}
+
+func OpenSheet(path string) (Sheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Sheet{}, err
+	}
+	defer f.Close()
+
+	var s Sheet
+	if strings.EqualFold(filepath.Ext(path), ".gdi") {
+		s, err = ParseGDI(f, filepath.Dir(path))
+	} else {
+		s, err = ParseCue(f, filepath.Dir(path))
+	}
+	s.Path = path
+	if err != nil {
+		return s, fmt.Errorf("%v: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseCue reads FILE and TRACK commands, everything else is ignored
+func ParseCue(r io.Reader, dir string) (Sheet, error) {
+	var s Sheet
+	currentFile := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			// FILE "name with spaces.bin" BINARY
+			name := strings.TrimSpace(line[len("FILE"):])
+			if i := strings.LastIndex(name, " "); i > 0 {
+				name = strings.TrimSpace(name[:i])
+			}
+			currentFile = filepath.Join(dir, strings.Trim(name, `"`))
+		case "TRACK":
+			if len(fields) < 3 {
+				return s, fmt.Errorf("invalid TRACK line %q", line)
+			}
+			if currentFile == "" {
+				return s, fmt.Errorf("TRACK before FILE %q", line)
+			}
+			n, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return s, fmt.Errorf("invalid track number %q", line)
+			}
+			mode := strings.ToUpper(fields[2])
+			s.Tracks = append(s.Tracks, Track{
+				Number: n,
+				Type:   mode,
+				Data:   strings.HasPrefix(mode, "MODE"),
+				Path:   currentFile,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return s, err
+	}
+	if len(s.Tracks) == 0 {
+		return s, fmt.Errorf("no tracks found")
+	}
+	return s, nil
+}
+
+// ParseGDI reads a track count line followed by one line per track:
+// number, start LBA, type, sector size, filename, offset. Filenames with
+// spaces are quoted.
+func ParseGDI(r io.Reader, dir string) (Sheet, error) {
+	var s Sheet
+	scanner := bufio.NewScanner(r)
+	count := -1
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+		if count < 0 {
+			n, err := strconv.Atoi(line)
+			if err != nil {
+				return s, fmt.Errorf("invalid track count %q", line)
+			}
+			count = n
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			return s, fmt.Errorf("invalid track line %q", line)
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return s, fmt.Errorf("invalid track number %q", line)
+		}
+		name := strings.Join(fields[4:len(fields)-1], " ")
+		if i := strings.Index(line, `"`); i >= 0 {
+			if j := strings.LastIndex(line, `"`); j > i {
+				name = line[i+1 : j]
+			}
+		}
+		s.Tracks = append(s.Tracks, Track{
+			Number: n,
+			Type:   fields[2],
+			Data:   fields[2] == "4",
+			Path:   filepath.Join(dir, name),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return s, err
+	}
+	if len(s.Tracks) == 0 {
+		return s, fmt.Errorf("no tracks found")
+	}
+	if count != len(s.Tracks) {
+		return s, fmt.Errorf("expected %v tracks, found %v", count, len(s.Tracks))
+	}
+	return s, nil
+}
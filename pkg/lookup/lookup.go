@@ -0,0 +1,240 @@
+package lookup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Read only lookups against a published Zaparoo Titles Database. Every lookup
+returns fully joined records ordered by TitleVariant ID, including the
+regions and languages of each variant, an empty slice means nothing matched.
+Hashes are case insensitive and serials are plain text, e.g. "SLUS-00594".
+Systems are either a Systems ID or a Zaparoo Core system ID such as "PSX", one
+Zaparoo system can cover several RDB systems.
+*/
+
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the sqlite file read only, settings.DBPath is where the build
+// writes it.
+func Open(path string) (*DB, error) {
+	db, err := sqlite.OpenZTDBReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// New wraps an already open database
+func New(db *sql.DB) *DB {
+	return &DB{db: db}
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func (d *DB) BySHA1(sha1 string) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnSHA1, strings.ToUpper(sha1), sqlite.RecordFilter{})
+}
+
+func (d *DB) ByMD5(md5 string) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnMD5, strings.ToUpper(md5), sqlite.RecordFilter{})
+}
+
+// ByCRC requires the size to agree when both sizes are known, CRC32 alone
+// collides too easily. A size of 0 matches any size.
+func (d *DB) ByCRC(crc string, size int64) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnCRC, strings.ToUpper(crc), sqlite.RecordFilter{Size: size})
+}
+
+// BySerial searches a single system, a systemID of 0 searches them all
+func (d *DB) BySerial(serial string, systemID int) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnSerial, rdb.EncodeSerial(serial), sqlite.RecordFilter{SystemID: systemID})
+}
+
+// BySerialZaparoo searches every system mapped to a Zaparoo Core system, an
+// empty zaparooSystemID searches them all
+func (d *DB) BySerialZaparoo(serial string, zaparooSystemID string) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnSerial, rdb.EncodeSerial(serial), sqlite.RecordFilter{ZaparooSystemID: zaparooSystemID})
+}
+
+// ByFilename matches the full filename including extension, a systemID of 0
+// searches every system
+func (d *DB) ByFilename(filename string, systemID int) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnFilename, filename, sqlite.RecordFilter{SystemID: systemID})
+}
+
+func (d *DB) ByFilenameZaparoo(filename string, zaparooSystemID string) ([]ztdb.TitleVariantRecord, error) {
+	return d.find(sqlite.ColumnFilename, filename, sqlite.RecordFilter{ZaparooSystemID: zaparooSystemID})
+}
+
+func (d *DB) find(column string, value string, filter sqlite.RecordFilter) ([]ztdb.TitleVariantRecord, error) {
+	if value == "" {
+		return []ztdb.TitleVariantRecord{}, nil
+	}
+	records, err := sqlite.FindTitleVariantRecords(d.db, column, value, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		fillTitle(&records[i])
+	}
+	return records, nil
+}
+
+// fillTitle derives the title from the variant name when it has no Titles row
+func fillTitle(r *ztdb.TitleVariantRecord) {
+	if r.Title != "" {
+		return
+	}
+	r.Title = ztdb.GetTitleFromVariant(r.Variant)
+}
+
+func (d *DB) Systems() ([]ztdb.System, error) {
+	return sqlite.GetSystems(d.db)
+}
+
+// Languages lists the language codes records and search filter by
+func (d *DB) Languages() ([]ztdb.GenericDBMeta, error) {
+	return sqlite.GetGenericMeta(d.db, sqlite.TableLanguage)
+}
+
+// Regions lists every region with its ISO code, parent and aliases
+func (d *DB) Regions() ([]ztdb.Region, error) {
+	return sqlite.GetRegions(d.db)
+}
+
+var ErrUnknownRegion = errors.New("unknown region")
+
+// PlayableIn returns the variants playable in a region given by name, ISO
+// code or alias: released there or in a region containing it such as Europe
+// or World, see ztdb.PlayableRegionIDs. filter narrows it to a title or
+// system.
+func (d *DB) PlayableIn(region string, filter sqlite.RecordFilter) ([]ztdb.TitleVariantRecord, error) {
+	regionID, err := sqlite.GetRegionID(d.db, region)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRegion, region)
+	} else if err != nil {
+		return nil, err
+	}
+	regions, err := sqlite.GetRegions(d.db)
+	if err != nil {
+		return nil, err
+	}
+	records, err := sqlite.FindTitleVariantRecordsInRegions(d.db, ztdb.PlayableRegionIDs(regions, regionID), filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		fillTitle(&records[i])
+	}
+	return records, nil
+}
+
+// SystemsByZaparooID returns every system mapped to a Zaparoo Core system ID
+func (d *DB) SystemsByZaparooID(zaparooSystemID string) ([]ztdb.System, error) {
+	systems, err := sqlite.GetSystems(d.db)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(systems, func(s ztdb.System) bool {
+		return zaparooSystemID == "" || s.ZaparooSystemID != zaparooSystemID
+	}), nil
+}
+
+// ByTitleID returns every variant of a title across all systems
+func (d *DB) ByTitleID(titleID int) ([]ztdb.TitleVariantRecord, error) {
+	records, err := sqlite.FindTitleVariantRecordsByTitleID(d.db, titleID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		fillTitle(&records[i])
+	}
+	return records, nil
+}
+
+// ByWorkID returns every variant of a game across systems, a record's WorkID
+// finds the other versions of what was matched
+func (d *DB) ByWorkID(workID int) ([]ztdb.TitleVariantRecord, error) {
+	records, err := sqlite.FindTitleVariantRecordsByWorkID(d.db, workID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		fillTitle(&records[i])
+	}
+	return records, nil
+}
+
+// Search needs the database built with the FTS5 search index and the
+// program built with -tags sqlite_fts5
+func (d *DB) Search(text string, opts sqlite.SearchOptions) ([]sqlite.SearchResult, error) {
+	return sqlite.SearchTitleVariants(d.db, text, opts)
+}
+
+// Query holds everything known about a file, empty fields are skipped
+type Query struct {
+	SHA1     string `json:"sha1,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	CRC      string `json:"crc,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Serial   string `json:"serial,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	SystemID int    `json:"system_id,omitempty"`
+	// ZaparooSystemID restricts matches like SystemID, both must agree when set
+	ZaparooSystemID string `json:"zaparoo_system_id,omitempty"`
+}
+
+type Result struct {
+	Query Query `json:"query"`
+	// MatchKey is the UniqueTypes name of the key that matched
+	MatchKey string                    `json:"match_key,omitempty"`
+	Records  []ztdb.TitleVariantRecord `json:"records"`
+}
+
+// Lookup tries each key of the query in match priority order, SHA1, MD5,
+// CRC32, serial then filename, and returns the records of the first key that
+// matches anything.
+func (d *DB) Lookup(q Query) (Result, error) {
+	result := Result{Query: q, Records: []ztdb.TitleVariantRecord{}}
+	keys := []struct {
+		key    string
+		lookup func() ([]ztdb.TitleVariantRecord, error)
+	}{
+		{"SHA1", func() ([]ztdb.TitleVariantRecord, error) { return d.BySHA1(q.SHA1) }},
+		{"MD5", func() ([]ztdb.TitleVariantRecord, error) { return d.ByMD5(q.MD5) }},
+		{"CRC32", func() ([]ztdb.TitleVariantRecord, error) { return d.ByCRC(q.CRC, q.Size) }},
+		{"SERIAL", func() ([]ztdb.TitleVariantRecord, error) { return d.BySerial(q.Serial, q.SystemID) }},
+		{"ROM", func() ([]ztdb.TitleVariantRecord, error) { return d.ByFilename(q.Filename, q.SystemID) }},
+	}
+	for _, k := range keys {
+		records, err := k.lookup()
+		if err != nil {
+			return result, err
+		}
+		if q.SystemID != 0 || q.ZaparooSystemID != "" {
+			records = slices.DeleteFunc(records, func(r ztdb.TitleVariantRecord) bool {
+				return (q.SystemID != 0 && r.Variant.SystemID != q.SystemID) ||
+					(q.ZaparooSystemID != "" && r.System.ZaparooSystemID != q.ZaparooSystemID)
+			})
+		}
+		if len(records) > 0 {
+			result.MatchKey = k.key
+			result.Records = records
+			return result, nil
+		}
+	}
+	return result, nil
+}
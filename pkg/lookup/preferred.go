@@ -0,0 +1,179 @@
+package lookup
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+// Preferences lists regions and languages best first, e.g. Regions "USA",
+// "Europe" and Languages "en". Names are case insensitive and match the
+// Regions table or the tags of the variant name, region ISO codes and aliases
+// such as "US" match their region. Empty fields are skipped.
+type Preferences struct {
+	Regions         []string `json:"regions,omitempty"`
+	Languages       []string `json:"languages,omitempty"`
+	SystemID        int      `json:"system_id,omitempty"`
+	ZaparooSystemID string   `json:"zaparoo_system_id,omitempty"`
+}
+
+type variantRank struct {
+	region, dump, language, clone int
+	version                       string
+}
+
+// PreferredVariant picks the variant of a title to launch, 1G1R style. It
+// ranks by the first preferred region a variant was released in, a release
+// of a region containing it such as World coming just after, then by ztdb DumpRank,
+// verified [!] dumps over unflagged ones over alternates over betas, hacks
+// and bad dumps, then the latest version and revision, then the first
+// preferred language, then parents over clones, then the lowest ID. Returns
+// false when the title has no variant on the preferred system.
+func (d *DB) PreferredVariant(titleID int, prefs Preferences) (ztdb.TitleVariantRecord, bool, error) {
+	records, err := d.ByTitleID(titleID)
+	if err != nil {
+		return ztdb.TitleVariantRecord{}, false, err
+	}
+	records = slices.DeleteFunc(records, func(r ztdb.TitleVariantRecord) bool {
+		return (prefs.SystemID != 0 && r.Variant.SystemID != prefs.SystemID) ||
+			(prefs.ZaparooSystemID != "" && r.System.ZaparooSystemID != prefs.ZaparooSystemID)
+	})
+	if len(records) == 0 {
+		return ztdb.TitleVariantRecord{}, false, nil
+	}
+
+	regions, err := sqlite.GetRegions(d.db)
+	if err != nil {
+		return ztdb.TitleVariantRecord{}, false, err
+	}
+	tree := newRegionTree(regions)
+	preferred := make([]regionPref, 0, len(prefs.Regions))
+	for _, name := range lowerAll(prefs.Regions) {
+		preferred = append(preferred, tree.pref(name))
+	}
+	languages := lowerAll(prefs.Languages)
+	ranks := make(map[int]variantRank, len(records))
+	for _, r := range records {
+		ranks[r.Variant.ID] = rankVariant(r, tree, preferred, languages)
+	}
+	// records are ordered by ID, a stable sort keeps the lowest ID first
+	sort.SliceStable(records, func(i, j int) bool {
+		x, y := ranks[records[i].Variant.ID], ranks[records[j].Variant.ID]
+		if x.region != y.region {
+			return x.region < y.region
+		}
+		if x.dump != y.dump {
+			return x.dump < y.dump
+		}
+		if x.version != y.version {
+			return x.version > y.version
+		}
+		if x.language != y.language {
+			return x.language < y.language
+		}
+		return x.clone < y.clone
+	})
+	return records[0], true, nil
+}
+
+func rankVariant(r ztdb.TitleVariantRecord, tree regionTree, preferred []regionPref, languages []string) variantRank {
+	tags := ztdb.GetFileFragments(r.Variant.Filename).Tags
+	if r.Variant.Name != "" {
+		tags = ztdb.ParseFileTags(r.Variant.Name)
+	}
+	released := tree.canonical(lowerAll(ztdb.GetVariantRegions(r.Variant, r.Region)))
+	released = append(released, tree.canonical(lowerAll(r.Regions))...)
+
+	rank := variantRank{
+		region:   2 * len(preferred),
+		dump:     tags.DumpRank(),
+		version:  ztdb.VersionKey(r.Variant.Version, r.Variant.Revision),
+		language: len(languages),
+	}
+	for i, pref := range preferred {
+		for _, region := range released {
+			if region == pref.name && 2*i < rank.region {
+				rank.region = 2 * i
+			} else if pref.playable[region] && 2*i+1 < rank.region {
+				rank.region = 2*i + 1
+			}
+		}
+	}
+	for _, language := range r.Languages {
+		if i := slices.Index(languages, language); i >= 0 && i < rank.language {
+			rank.language = i
+		}
+	}
+	if r.Variant.ParentVariantID != 0 {
+		rank.clone = 1
+	}
+	return rank
+}
+
+// regionTree resolves lowercase region names, ISO codes and aliases
+type regionTree struct {
+	regions []ztdb.Region
+	byName  map[string]ztdb.Region
+}
+
+// regionPref is a preferred region by lowercase name and the lowercase names
+// of the regions whose releases are playable in it, the region and the
+// regions containing it. A World release is playable when Europe is
+// preferred, a German one isn't.
+type regionPref struct {
+	name     string
+	playable map[string]bool
+}
+
+func newRegionTree(regions []ztdb.Region) regionTree {
+	t := regionTree{regions: regions, byName: make(map[string]ztdb.Region)}
+	for _, region := range regions {
+		for _, name := range region.Names() {
+			t.byName[name] = region
+		}
+	}
+	return t
+}
+
+// pref keeps names that aren't regions as written, they only match the same
+// tag
+func (t regionTree) pref(name string) regionPref {
+	p := regionPref{name: name, playable: make(map[string]bool)}
+	region, ok := t.byName[name]
+	if !ok {
+		return p
+	}
+	p.name = strings.ToLower(region.Name)
+	names := make(map[int]string, len(t.regions))
+	for _, r := range t.regions {
+		names[r.ID] = strings.ToLower(r.Name)
+	}
+	for _, id := range ztdb.PlayableRegionIDs(t.regions, region.ID) {
+		p.playable[names[id]] = true
+	}
+	return p
+}
+
+// canonical swaps lowercase region aliases for their region name, other
+// values are kept
+func (t regionTree) canonical(values []string) []string {
+	canonical := make([]string, len(values))
+	for i, v := range values {
+		if region, ok := t.byName[v]; ok {
+			v = strings.ToLower(region.Name)
+		}
+		canonical[i] = v
+	}
+	return canonical
+}
+
+func lowerAll(values []string) []string {
+	lower := make([]string, len(values))
+	for i, v := range values {
+		lower[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return lower
+}
@@ -0,0 +1,121 @@
+package match
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+)
+
+type ArchiveEntry struct {
+	Name string
+	Size int64
+	// CRC is the CRC32 stored in the archive directory, empty when the
+	// archive doesn't record one
+	CRC  string
+	open func() (io.ReadCloser, error)
+}
+
+func (e ArchiveEntry) Open() (io.ReadCloser, error) {
+	return e.open()
+}
+
+func IsArchive(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip", ".7z":
+		return true
+	}
+	return false
+}
+
+// OpenArchive lists the file entries of a zip or 7z archive, the returned
+// closer must be closed after the entries are no longer needed.
+func OpenArchive(path string) ([]ArchiveEntry, io.Closer, error) {
+	entries := make([]ArchiveEntry, 0)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zip":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return entries, nil, err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			entries = append(entries, ArchiveEntry{
+				Name: f.Name,
+				Size: int64(f.UncompressedSize64),
+				CRC:  fmt.Sprintf("%08X", f.CRC32),
+				open: f.Open,
+			})
+		}
+		return entries, zr, nil
+	case ".7z":
+		sr, err := sevenzip.OpenReader(path)
+		if err != nil {
+			return entries, nil, err
+		}
+		for _, f := range sr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			crc := ""
+			if f.CRC32 != 0 || f.UncompressedSize == 0 {
+				crc = fmt.Sprintf("%08X", f.CRC32)
+			}
+			entries = append(entries, ArchiveEntry{
+				Name: f.Name,
+				Size: int64(f.UncompressedSize),
+				CRC:  crc,
+				open: f.Open,
+			})
+		}
+		return entries, sr, nil
+	}
+	return entries, nil, fmt.Errorf("unsupported archive %v", path)
+}
+
+// MatchArchive matches every entry of an archive. The stored CRC32 is tried
+// first so most entries never need decompressing, entries without a CRC
+// match (or all entries when FullHash is set) are streamed for MD5/SHA1. An
+// entry that can't be read or looked up gets its Error set, keeping the
+// hashes known so far, and the rest are still matched. Only failing to open
+// the archive returns an error.
+func (m *Matcher) MatchArchive(path string) ([]Match, error) {
+	matches := make([]Match, 0)
+	entries, closer, err := OpenArchive(path)
+	if err != nil {
+		return matches, err
+	}
+	defer closer.Close()
+
+	for _, entry := range entries {
+		match, err := m.matchEntry(entry)
+		if err != nil {
+			match.Error = err.Error()
+		}
+		match.Path = path
+		match.Entry = entry.Name
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func (m *Matcher) matchEntry(entry ArchiveEntry) (Match, error) {
+	if entry.CRC != "" && !m.FullHash {
+		match, err := m.Lookup(Hashes{Size: entry.Size, CRC: entry.CRC}, nil, "")
+		if err != nil || match.Matched {
+			return match, err
+		}
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return Match{Hashes: Hashes{Size: entry.Size, CRC: entry.CRC}}, err
+	}
+	defer rc.Close()
+	return m.MatchReader(rc, filepath.Base(entry.Name), entry.Size)
+}
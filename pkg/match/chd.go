@@ -0,0 +1,215 @@
+package match
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/chd"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/disc"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+var trackSuffix = regexp.MustCompile(`\s*\(Track \d+\)$`)
+
+// MatchCHD identifies a CHD. DVD CHDs store the ISO as raw data so the
+// header's raw SHA1 matches the dump. CD CHDs hash frames with subcode, so
+// each track is decompressed and hashed like the BIN files of a sheet. A CD
+// whose tracks can't be read, such as one stored as a diff against a parent
+// CHD, falls back to the weaker KeyTrackSizes.
+func (m *Matcher) MatchCHD(path string) (Match, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Match{Path: path}, err
+	}
+	defer f.Close()
+	c, err := chd.Read(f)
+	if err != nil {
+		return Match{Path: path}, fmt.Errorf("%v: %w", path, err)
+	}
+
+	h := Hashes{Size: int64(c.Header.LogicalBytes), SHA1: c.Header.RawSHA1}
+	match, err := m.Lookup(h, nil, "")
+	if err != nil || match.Matched || len(c.Tracks) == 0 {
+		match.Path = path
+		return match, err
+	}
+
+	files, hashes, readable := hashCHDTracks(f, c)
+	match, ok, err := m.matchDisc(path, files, hashes, readable)
+	if err != nil || ok {
+		return match, err
+	}
+
+	// without a track list the first data track is matched like a BIN file,
+	// tracks that hash to an unknown dump aren't matched by their sizes
+	first := -1
+	for i, f := range files {
+		if readable[i] && (first < 0 || (f.Data && !files[first].Data)) {
+			first = i
+		}
+	}
+	if first >= 0 {
+		match, err = m.Lookup(hashes[first], nil, "")
+	} else {
+		match = Match{Hashes: h}
+	}
+	match.Path = path
+	match.Tracks = make([]TrackMatch, 0, len(files))
+	for i, f := range files {
+		status := TrackUnknown
+		if !readable[i] {
+			status = TrackMissing
+		}
+		match.Tracks = append(match.Tracks, TrackMatch{
+			Number: f.Number,
+			Hashes: hashes[i],
+			Status: status,
+		})
+	}
+	if err != nil || first >= 0 {
+		return match, err
+	}
+
+	tv, ok, err := m.matchTracks(c.Tracks)
+	if err != nil || !ok {
+		return match, err
+	}
+	match.Matched = true
+	match.MatchKey = KeyTrackSizes
+	match.Variant = tv
+	m.describe(&match)
+	return match, nil
+}
+
+// hashCHDTracks hashes every track of a CD CHD as its BIN file, tracks whose
+// hunks can't be decompressed aren't readable
+func hashCHDTracks(r io.ReaderAt, c chd.CHD) ([]disc.Track, []Hashes, []bool) {
+	files := make([]disc.Track, len(c.Tracks))
+	hashes := make([]Hashes, len(c.Tracks))
+	readable := make([]bool, len(c.Tracks))
+	hunks, hunksErr := chd.NewHunks(r, c.Header)
+	for i, t := range c.Tracks {
+		files[i] = disc.Track{Number: t.Number, Type: t.Type, Data: !t.IsAudio()}
+		if hunksErr != nil {
+			continue
+		}
+		tr, err := c.TrackReader(hunks, i)
+		if err != nil {
+			continue
+		}
+		h, err := HashReader(tr)
+		if err != nil {
+			continue
+		}
+		hashes[i] = h
+		readable[i] = true
+	}
+	return files, hashes, readable
+}
+
+// matchTracks finds discs whose TitleVariantTracks have the CHD's track
+// sizes, only used when the tracks can't be hashed. Without a track list,
+// variants whose first track has the size of the CHD's first track are used,
+// when the other tracks of the disc are known their sizes must agree as well.
+// Only an unambiguous dump is returned.
+func (m *Matcher) matchTracks(tracks []chd.Track) (ztdb.TitleVariant, bool, error) {
+	sizes := make([]int64, 0, len(tracks))
+	for _, t := range tracks {
+		sizes = append(sizes, t.Size())
+	}
+
+	tv, ok, err := m.matchTrackRows(sizes)
+	if err != nil || ok {
+		return tv, ok, err
+	}
+
+	candidates, err := sqlite.FindTitleVariantsBySize(m.db, sizes[0])
+	if err != nil {
+		return ztdb.TitleVariant{}, false, err
+	}
+	matched := make([]ztdb.TitleVariant, 0)
+	for _, tv := range candidates {
+		frag := ztdb.GetFileFragments(tv.Filename)
+		base := trackSuffix.ReplaceAllString(frag.FileNameNoExt, "")
+		if base != frag.FileNameNoExt {
+			siblings, err := sqlite.FindTitleVariantsByFilenamePrefix(m.db, tv.SystemID, base+" (Track ")
+			if err != nil {
+				return ztdb.TitleVariant{}, false, err
+			}
+			if len(siblings) > 1 && !sameTrackSizes(siblings, sizes) {
+				continue
+			}
+		} else if len(sizes) > 1 {
+			// a single file dump can't be a multi track disc
+			continue
+		}
+		matched = append(matched, tv)
+	}
+
+	if len(matched) == 0 {
+		return ztdb.TitleVariant{}, false, nil
+	}
+	for _, tv := range matched[1:] {
+		if tv.SHA1 != matched[0].SHA1 {
+			return ztdb.TitleVariant{}, false, nil
+		}
+	}
+	return matched[0], true, nil
+}
+
+func sameTrackSizes(tvs []ztdb.TitleVariant, sizes []int64) bool {
+	seen := make(map[string]bool)
+	trackSizes := make([]int64, 0, len(tvs))
+	for _, tv := range tvs {
+		if seen[tv.Filename] {
+			continue
+		}
+		seen[tv.Filename] = true
+		trackSizes = append(trackSizes, int64(tv.Size))
+	}
+	if len(trackSizes) != len(sizes) {
+		return false
+	}
+	for i := range sizes {
+		if trackSizes[i] != sizes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Matcher) matchTrackRows(sizes []int64) (ztdb.TitleVariant, bool, error) {
+	firsts, err := sqlite.FindTitleVariantTracksBySize(m.db, 1, sizes[0])
+	if err != nil {
+		return ztdb.TitleVariant{}, false, err
+	}
+	discIDs := make([]int, 0)
+	for _, first := range firsts {
+		tracks, err := sqlite.GetTitleVariantTracks(m.db, first.TitleVariantID)
+		if err != nil {
+			return ztdb.TitleVariant{}, false, err
+		}
+		if len(tracks) != len(sizes) {
+			continue
+		}
+		same := true
+		for i, t := range tracks {
+			if int64(t.Size) != sizes[i] {
+				same = false
+				break
+			}
+		}
+		if same && !slices.Contains(discIDs, first.TitleVariantID) {
+			discIDs = append(discIDs, first.TitleVariantID)
+		}
+	}
+	if len(discIDs) != 1 {
+		return ztdb.TitleVariant{}, false, nil
+	}
+	tv, err := sqlite.GetTitleVariant(m.db, discIDs[0])
+	return tv, err == nil, err
+}
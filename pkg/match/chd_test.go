@@ -0,0 +1,216 @@
+package match
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+const psxSystemID = 121
+
+// testMatcher is a Matcher over an in-memory database holding a PlayStation
+// disc whose tracks are the given BIN files
+func testMatcher(t *testing.T, discs map[int][][]byte) *Matcher {
+	t.Helper()
+	db, err := sqlite.OpenMemoryZTDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = sqlite.BulkInsertSystems(db, []ztdb.System{{ID: psxSystemID, Name: "Sony - PlayStation.rdb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trackID := 1
+	for id, bins := range discs {
+		name := fmt.Sprintf("Disc %v (USA)", id)
+		err = sqlite.InsertTitleVariants(db, ztdb.TitleVariant{
+			ID:       id,
+			SystemID: psxSystemID,
+			Filename: name + ".cue",
+			Name:     name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracks := make([]ztdb.TitleVariantTrack, 0, len(bins))
+		for i, bin := range bins {
+			sum := sha1.Sum(bin)
+			tracks = append(tracks, ztdb.TitleVariantTrack{
+				ID:             trackID,
+				TitleVariantID: id,
+				Number:         i + 1,
+				Filename:       fmt.Sprintf("%v (Track %v).bin", name, i+1),
+				SHA1:           strings.ToUpper(hex.EncodeToString(sum[:])),
+				Size:           len(bin),
+			})
+			trackID++
+		}
+		err = sqlite.BulkInsertTitleVariantTracks(db, tracks)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewMatcher(db)
+}
+
+// testBIN is a track of n raw frames
+func testBIN(n int, fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, n*2352)
+}
+
+// writeTestCHD writes an uncompressed CD CHD of the given tracks, the first
+// a data track and the rest audio. With missingHunks the map points past the
+// end of the file so no track can be read.
+func writeTestCHD(t *testing.T, path string, bins [][]byte, missingHunks bool) {
+	t.Helper()
+	const unit = 2352 + 96
+	const hunkUnits = 4
+	units := make([]byte, 0)
+	meta := make([]byte, 0)
+	metaOffset := 124
+	for i, bin := range bins {
+		frames := len(bin) / 2352
+		kind := "AUDIO"
+		data := bin
+		if i == 0 {
+			kind = "MODE2_RAW"
+		} else {
+			// audio is stored big-endian
+			data = bytes.Clone(bin)
+			for j := 0; j < len(data); j += 2 {
+				data[j], data[j+1] = data[j+1], data[j]
+			}
+		}
+		padded := (frames + 3) / 4 * 4
+		for f := range padded {
+			frame := make([]byte, unit)
+			if f < frames {
+				copy(frame, data[f*2352:(f+1)*2352])
+			}
+			units = append(units, frame...)
+		}
+
+		text := fmt.Sprintf("TRACK:%v TYPE:%v SUBTYPE:NONE FRAMES:%v PREGAP:0 PGTYPE:%v PGSUB:RW POSTGAP:0\x00", i+1, kind, frames, kind)
+		entry := make([]byte, 16)
+		copy(entry, "CHT2")
+		binary.BigEndian.PutUint32(entry[4:], uint32(len(text)))
+		if i < len(bins)-1 {
+			binary.BigEndian.PutUint64(entry[8:], uint64(metaOffset+len(meta)+16+len(text)))
+		}
+		meta = append(meta, entry...)
+		meta = append(meta, text...)
+	}
+
+	hunkBytes := hunkUnits * unit
+	hunks := len(units) / hunkBytes
+	mapOffset := metaOffset + len(meta)
+	dataOffset := (mapOffset + hunks*4 + hunkBytes - 1) / hunkBytes * hunkBytes
+	if missingHunks {
+		dataOffset += 1000 * hunkBytes
+	}
+	rawMap := make([]byte, hunks*4)
+	for n := range hunks {
+		binary.BigEndian.PutUint32(rawMap[n*4:], uint32(dataOffset/hunkBytes+n))
+	}
+
+	header := make([]byte, 124)
+	copy(header, "MComprHD")
+	binary.BigEndian.PutUint32(header[8:], 124)
+	binary.BigEndian.PutUint32(header[12:], 5)
+	binary.BigEndian.PutUint64(header[32:], uint64(len(units)))
+	binary.BigEndian.PutUint64(header[40:], uint64(mapOffset))
+	binary.BigEndian.PutUint64(header[48:], uint64(metaOffset))
+	binary.BigEndian.PutUint32(header[56:], uint32(hunkBytes))
+	binary.BigEndian.PutUint32(header[60:], unit)
+
+	file := bytes.Join([][]byte{header, meta, rawMap}, nil)
+	if !missingHunks {
+		file = append(file, make([]byte, dataOffset-len(file))...)
+		file = append(file, units...)
+	}
+	err := os.WriteFile(path, file, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchCHD(t *testing.T) {
+	disc := [][]byte{testBIN(10, 0x11), testBIN(6, 0x22)}
+	other := [][]byte{testBIN(10, 0x33), testBIN(6, 0x44)}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		discs        map[int][][]byte
+		bins         [][]byte
+		missingHunks bool
+		key          string
+		variantID    int
+		status       string
+	}{
+		{"tracks hashed", map[int][][]byte{1: disc, 2: other}, disc, false, KeyTracks, 1, TrackOK},
+		{"unknown dump of known sizes", map[int][][]byte{2: other}, disc, false, "", 0, TrackUnknown},
+		{"unreadable tracks", map[int][][]byte{2: other}, disc, true, KeyTrackSizes, 2, TrackMissing},
+		{"unreadable tracks of ambiguous sizes", map[int][][]byte{1: disc, 2: other}, disc, true, "", 0, TrackMissing},
+	}
+	for i, tt := range tests {
+		m := testMatcher(t, tt.discs)
+		path := filepath.Join(dir, fmt.Sprintf("%v.chd", i))
+		writeTestCHD(t, path, tt.bins, tt.missingHunks)
+		match, err := m.MatchCHD(path)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.name, err)
+		}
+		if match.MatchKey != tt.key || match.Variant.ID != tt.variantID {
+			t.Errorf("%v: matched variant %v by %q, want %v by %q", tt.name, match.Variant.ID, match.MatchKey, tt.variantID, tt.key)
+		}
+		if len(match.Tracks) != len(tt.bins) {
+			t.Fatalf("%v: %v tracks, want %v", tt.name, len(match.Tracks), len(tt.bins))
+		}
+		for _, tm := range match.Tracks {
+			if tm.Status != tt.status {
+				t.Errorf("%v: track %v is %v, want %v", tt.name, tm.Number, tm.Status, tt.status)
+			}
+		}
+	}
+}
+
+func TestMatchCHDFirstTrack(t *testing.T) {
+	disc := [][]byte{testBIN(10, 0x11), testBIN(6, 0x22)}
+	m := testMatcher(t, nil)
+	sum := sha1.Sum(disc[0])
+	err := sqlite.InsertTitleVariants(m.db, ztdb.TitleVariant{
+		ID:       7,
+		SystemID: psxSystemID,
+		Filename: "Disc 7 (Europe) (Track 1).bin",
+		SHA1:     strings.ToUpper(hex.EncodeToString(sum[:])),
+		Size:     len(disc[0]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "disc.chd")
+	writeTestCHD(t, path, disc, false)
+	match, err := m.MatchCHD(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.MatchKey != KeySHA1 || match.Variant.ID != 7 {
+		t.Errorf("matched variant %v by %q, want 7 by %q", match.Variant.ID, match.MatchKey, KeySHA1)
+	}
+	if len(match.Tracks) != 2 || match.Tracks[1].Status != TrackUnknown {
+		t.Errorf("tracks %+v, want 2 of unknown status", match.Tracks)
+	}
+}
@@ -0,0 +1,88 @@
+package match
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+type Hashes struct {
+	Size int64  `json:"size"`
+	CRC  string `json:"crc"`
+	MD5  string `json:"md5"`
+	SHA1 string `json:"sha1"`
+}
+
+type hasher struct {
+	crc hash.Hash32
+	md  hash.Hash
+	sha hash.Hash
+	n   int64
+}
+
+func newHasher() *hasher {
+	return &hasher{
+		crc: crc32.NewIEEE(),
+		md:  md5.New(),
+		sha: sha1.New(),
+	}
+}
+
+func (h *hasher) Write(p []byte) (int, error) {
+	h.crc.Write(p)
+	h.md.Write(p)
+	h.sha.Write(p)
+	h.n += int64(len(p))
+	return len(p), nil
+}
+
+// Hashes are formatted as the uppercase hex stored in TitleVariants
+func (h *hasher) Hashes() Hashes {
+	return Hashes{
+		Size: h.n,
+		CRC:  fmt.Sprintf("%08X", h.crc.Sum32()),
+		MD5:  strings.ToUpper(hex.EncodeToString(h.md.Sum(nil))),
+		SHA1: strings.ToUpper(hex.EncodeToString(h.sha.Sum(nil))),
+	}
+}
+
+// HashReader computes CRC32, MD5 and SHA1 in a single pass.
+func HashReader(r io.Reader) (Hashes, error) {
+	h := newHasher()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return Hashes{}, err
+	}
+	return h.Hashes(), nil
+}
+
+// HashReaderSkip hashes the whole stream and the stream without its first
+// skip bytes in the same pass, returning the raw and headerless hashes.
+func HashReaderSkip(r io.Reader, skip int64) (Hashes, Hashes, error) {
+	raw := newHasher()
+	stripped := newHasher()
+	_, err := io.CopyN(raw, r, skip)
+	if err != nil {
+		return Hashes{}, Hashes{}, err
+	}
+	_, err = io.Copy(io.MultiWriter(raw, stripped), r)
+	if err != nil {
+		return Hashes{}, Hashes{}, err
+	}
+	return raw.Hashes(), stripped.Hashes(), nil
+}
+
+func HashFile(path string) (Hashes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Hashes{}, err
+	}
+	defer f.Close()
+	return HashReader(f)
+}
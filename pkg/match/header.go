@@ -0,0 +1,107 @@
+package match
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+No-Intro hashes several cartridge systems without the headers emulators and
+copiers add to dumps. Rules detect those headers from the start of a file so
+the hash pipeline can skip them, new systems only need a new rule.
+*/
+
+// headerPeekSize is how much of a file is available to rule detection
+const headerPeekSize = 512
+
+type HeaderRule struct {
+	Name string
+	// Exts limits a rule to file extensions, for headers without a magic
+	Exts []string
+	// Detect returns how many leading bytes to skip, 0 when there's no header
+	Detect func(head []byte, size int64) int64
+}
+
+func magicHeader(offset int, magic string, headerSize int64) func([]byte, int64) int64 {
+	return func(head []byte, size int64) int64 {
+		if size <= headerSize || len(head) < offset+len(magic) {
+			return 0
+		}
+		if !bytes.Equal(head[offset:offset+len(magic)], []byte(magic)) {
+			return 0
+		}
+		return headerSize
+	}
+}
+
+var (
+	HeaderINES = HeaderRule{
+		Name:   "iNES",
+		Detect: magicHeader(0, "NES\x1a", 16),
+	}
+	HeaderFDS = HeaderRule{
+		Name:   "fwNES",
+		Detect: magicHeader(0, "FDS\x1a", 16),
+	}
+	HeaderLynx = HeaderRule{
+		Name:   "LNX",
+		Detect: magicHeader(0, "LYNX", 64),
+	}
+	HeaderA78 = HeaderRule{
+		Name:   "A78",
+		Detect: magicHeader(1, "ATARI7800", 128),
+	}
+	HeaderSMC = HeaderRule{
+		Name: "SMC",
+		Exts: []string{".smc", ".sfc", ".swc", ".fig"},
+		Detect: func(head []byte, size int64) int64 {
+			if size%1024 == 512 {
+				return 512
+			}
+			return 0
+		},
+	}
+)
+
+// HeaderRules is keyed by ztdb.System name
+var HeaderRules = map[string][]HeaderRule{
+	"Nintendo - Nintendo Entertainment System.rdb": {HeaderINES},
+	"Nintendo - Family Computer Disk System.rdb":   {HeaderFDS},
+	"Atari - Lynx.rdb": {HeaderLynx},
+	"Atari - 7800.rdb": {HeaderA78},
+	"Nintendo - Super Nintendo Entertainment System.rdb": {HeaderSMC},
+}
+
+func RegisterHeaderRule(system string, rule HeaderRule) {
+	HeaderRules[system] = append(HeaderRules[system], rule)
+}
+
+// DetectHeader checks the start of a file against the rules of system, or of
+// every system when system is empty, returning the first system and rule with
+// a header to skip.
+func DetectHeader(system string, filename string, head []byte, size int64) (string, HeaderRule, int64) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	systems := []string{system}
+	if system == "" {
+		systems = make([]string, 0, len(HeaderRules))
+		for system := range HeaderRules {
+			systems = append(systems, system)
+		}
+		sort.Strings(systems)
+	}
+
+	for _, system := range systems {
+		for _, rule := range HeaderRules[system] {
+			if len(rule.Exts) > 0 && !slices.Contains(rule.Exts, ext) {
+				continue
+			}
+			if skip := rule.Detect(head, size); skip > 0 {
+				return system, rule, skip
+			}
+		}
+	}
+	return "", HeaderRule{}, 0
+}
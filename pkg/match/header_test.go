@@ -0,0 +1,54 @@
+package match
+
+import (
+	"bytes"
+	"testing"
+)
+
+// withHeader puts header in front of a rom, padding it to size
+func withHeader(header string, size int, rom []byte) []byte {
+	h := make([]byte, size)
+	copy(h, header)
+	return append(h, rom...)
+}
+
+func TestDetectHeader(t *testing.T) {
+	prg := bytes.Repeat([]byte{0x4c}, 16*1024)
+	fds := append([]byte("\x01*NINTENDO-HVC*"), make([]byte, 65500)...)
+	lynx := bytes.Repeat([]byte{0xff}, 128*1024)
+	a78 := bytes.Repeat([]byte{0xea}, 32*1024)
+	sfc := bytes.Repeat([]byte{0x78}, 512*1024)
+
+	tests := []struct {
+		name     string
+		system   string
+		filename string
+		data     []byte
+		rule     string
+		skip     int64
+	}{
+		{"NES headered", "Nintendo - Nintendo Entertainment System.rdb", "Game.nes", withHeader("NES\x1a", 16, prg), "iNES", 16},
+		{"NES stripped", "Nintendo - Nintendo Entertainment System.rdb", "Game.nes", prg, "", 0},
+		{"FDS headered", "Nintendo - Family Computer Disk System.rdb", "Game.fds", withHeader("FDS\x1a", 16, fds), "fwNES", 16},
+		{"FDS stripped", "Nintendo - Family Computer Disk System.rdb", "Game.fds", fds, "", 0},
+		{"Lynx headered", "Atari - Lynx.rdb", "Game.lnx", withHeader("LYNX", 64, lynx), "LNX", 64},
+		{"Lynx stripped", "Atari - Lynx.rdb", "Game.lyx", lynx, "", 0},
+		{"7800 headered", "Atari - 7800.rdb", "Game.a78", withHeader("\x01ATARI7800", 128, a78), "A78", 128},
+		{"7800 stripped", "Atari - 7800.rdb", "Game.a78", a78, "", 0},
+		{"SMC headered", "Nintendo - Super Nintendo Entertainment System.rdb", "Game.smc", withHeader("", 512, sfc), "SMC", 512},
+		{"SMC stripped", "Nintendo - Super Nintendo Entertainment System.rdb", "Game.sfc", sfc, "", 0},
+		{"SMC other extension", "Nintendo - Super Nintendo Entertainment System.rdb", "Game.bin", withHeader("", 512, sfc), "", 0},
+		{"other system's header", "Atari - Lynx.rdb", "Game.lnx", withHeader("NES\x1a", 16, prg), "", 0},
+		{"any system", "", "Game.nes", withHeader("NES\x1a", 16, prg), "iNES", 16},
+	}
+	for _, tt := range tests {
+		head := tt.data
+		if len(head) > headerPeekSize {
+			head = head[:headerPeekSize]
+		}
+		_, rule, skip := DetectHeader(tt.system, tt.filename, head, int64(len(tt.data)))
+		if rule.Name != tt.rule || skip != tt.skip {
+			t.Errorf("%v: DetectHeader = %q, %v, want %q, %v", tt.name, rule.Name, skip, tt.rule, tt.skip)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package match
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/disc"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/rdb"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/serial"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+// Match keys use the same names as UniqueTypes
+const (
+	KeySHA1   string = "SHA1"
+	KeyMD5    string = "MD5"
+	KeyCRC32  string = "CRC32"
+	KeySerial string = "SERIAL"
+	KeyROM    string = "ROM"
+	// KeyTracks is a disc matched by the SHA1 of its track files or CHD tracks
+	KeyTracks string = "TRACKS"
+	// KeyTrackSizes is a CHD matched by its track sizes alone because its
+	// tracks couldn't be hashed, weaker than every other key
+	KeyTrackSizes string = "TRACK_SIZES"
+)
+
+type Match struct {
+	Path     string            `json:"path"`
+	Entry    string            `json:"entry,omitempty"`
+	Hashes   Hashes            `json:"hashes"`
+	Serial   string            `json:"serial,omitempty"`
+	Header   string            `json:"header,omitempty"`
+	Matched  bool              `json:"matched"`
+	MatchKey string            `json:"match_key,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	System   string            `json:"system,omitempty"`
+	Region   string            `json:"region,omitempty"`
+	Variant  ztdb.TitleVariant `json:"variant"`
+	Tracks   []TrackMatch      `json:"tracks,omitempty"`
+	// Error is why an archive entry couldn't be matched
+	Error string `json:"error,omitempty"`
+}
+
+type Matcher struct {
+	// FullHash always hashes archive entries instead of trusting a CRC32 match
+	FullHash bool
+	// SystemID is the system being scanned, filenames only match its
+	// variants. When 0 a filename only matches when every variant with that
+	// filename is on one system.
+	SystemID int
+
+	db *sql.DB
+}
+
+func NewMatcher(db *sql.DB) *Matcher {
+	return &Matcher{db: db}
+}
+
+// Lookup finds the best TitleVariant using the same priority as indexunique:
+// SHA1, MD5, CRC32 (with size), serials in order, then filename on the
+// scanned system, see SystemID. Serials are plain text.
+func (m *Matcher) Lookup(h Hashes, serials []string, filename string) (Match, error) {
+	match := Match{Hashes: h}
+	if len(serials) > 0 {
+		match.Serial = serials[0]
+	}
+
+	type candidate struct {
+		key    string
+		column string
+		value  string
+		serial string
+	}
+	candidates := []candidate{
+		{KeySHA1, sqlite.ColumnSHA1, h.SHA1, ""},
+		{KeyMD5, sqlite.ColumnMD5, h.MD5, ""},
+		{KeyCRC32, sqlite.ColumnCRC, h.CRC, ""},
+	}
+	for _, serial := range serials {
+		candidates = append(candidates, candidate{KeySerial, sqlite.ColumnSerial, rdb.EncodeSerial(serial), serial})
+	}
+	candidates = append(candidates, candidate{KeyROM, sqlite.ColumnFilename, filename, ""})
+
+	for _, c := range candidates {
+		if c.value == "" {
+			continue
+		}
+		tvs, err := m.findTitleVariants(c.column, c.value)
+		if err != nil {
+			return match, err
+		}
+		for _, tv := range tvs {
+			// CRC32 collides easily, require the size to agree when known
+			if c.key == KeyCRC32 && tv.Size != 0 && h.Size != 0 && int64(tv.Size) != h.Size {
+				continue
+			}
+			match.Matched = true
+			match.MatchKey = c.key
+			if c.serial != "" {
+				match.Serial = c.serial
+			}
+			match.Variant = tv
+			m.describe(&match)
+			return match, nil
+		}
+	}
+	return match, nil
+}
+
+// systemName is the HeaderRules key of SystemID, empty when no system is set
+func (m *Matcher) systemName() string {
+	if m.SystemID == 0 {
+		return ""
+	}
+	name, _ := sqlite.GetMetaName(m.db, sqlite.TableSystem, m.SystemID)
+	return name
+}
+
+// findTitleVariants keeps filename lookups to the scanned system, names such
+// as "Track 01.bin" are shared by unrelated games
+func (m *Matcher) findTitleVariants(column string, value string) ([]ztdb.TitleVariant, error) {
+	if column != sqlite.ColumnFilename {
+		return sqlite.FindTitleVariants(m.db, column, value)
+	}
+	if m.SystemID != 0 {
+		return sqlite.FindTitleVariantsOnSystem(m.db, column, value, m.SystemID)
+	}
+	tvs, err := sqlite.FindTitleVariants(m.db, column, value)
+	for _, tv := range tvs {
+		if tv.SystemID != tvs[0].SystemID {
+			return nil, err
+		}
+	}
+	return tvs, err
+}
+
+func (m *Matcher) describe(match *Match) {
+	tv := match.Variant
+	match.System, _ = sqlite.GetMetaName(m.db, sqlite.TableSystem, tv.SystemID)
+	match.Region, _ = sqlite.GetMetaName(m.db, sqlite.TableRegion, tv.RegionID)
+	title, err := sqlite.GetMetaName(m.db, sqlite.TableTitle, tv.TitleID)
+	if err != nil || title == "" {
+		name := tv.Name
+		if name == "" {
+			name = ztdb.GetFileFragments(tv.Filename).FileNameNoExt
+		}
+		title = ztdb.GetTitleFromName(name)
+	}
+	match.Title = title
+}
+
+func (m *Matcher) MatchFile(path string) (Match, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Match{Path: path}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Match{Path: path}, err
+	}
+	var serials []string
+	if serial.IsImage(path) {
+		// images without a recognisable header are still matched by hash
+		serials, _ = serial.FromImage(path)
+	}
+	match, err := m.matchReader(f, filepath.Base(path), fi.Size(), serials)
+	match.Path = path
+	return match, err
+}
+
+// MatchReader hashes a file stream, when a HeaderRules header of the scanned
+// system (any system when SystemID is 0) is detected the headerless hashes
+// are looked up first and the raw hashes second.
+func (m *Matcher) MatchReader(r io.Reader, filename string, size int64) (Match, error) {
+	return m.matchReader(r, filename, size, nil)
+}
+
+func (m *Matcher) matchReader(r io.Reader, filename string, size int64, serials []string) (Match, error) {
+	br := bufio.NewReaderSize(r, headerPeekSize)
+	head, _ := br.Peek(headerPeekSize)
+	_, rule, skip := DetectHeader(m.systemName(), filename, head, size)
+	if skip == 0 {
+		h, err := HashReader(br)
+		if err != nil {
+			return Match{Hashes: Hashes{Size: size}}, err
+		}
+		return m.Lookup(h, serials, filename)
+	}
+
+	raw, stripped, err := HashReaderSkip(br, skip)
+	if err != nil {
+		return Match{Hashes: Hashes{Size: size}}, err
+	}
+	match, err := m.Lookup(stripped, nil, "")
+	if err != nil || match.Matched {
+		match.Header = rule.Name
+		return match, err
+	}
+	return m.Lookup(raw, serials, filename)
+}
+
+// ScanDir walks dir and calls cb with the match result of every regular file,
+// zip and 7z archives report one match per entry and CHDs are matched by
+// their header SHA1 or their tracks. Files referenced by a .cue or .gdi sheet
+// are reported as part of the sheet's match only.
+func (m *Matcher) ScanDir(dir string, cb func(Match, error)) error {
+	claimed := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || !disc.IsSheet(path) {
+			return nil
+		}
+		sheet, err := disc.OpenSheet(path)
+		if err != nil {
+			return nil
+		}
+		for _, t := range sheet.Tracks {
+			claimed[filepath.Clean(t.Path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			cb(Match{Path: path}, err)
+			return nil
+		}
+		if !d.Type().IsRegular() || claimed[filepath.Clean(path)] {
+			return nil
+		}
+		if disc.IsSheet(path) {
+			cb(m.MatchSheet(path))
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ".chd") {
+			cb(m.MatchCHD(path))
+			return nil
+		}
+		if IsArchive(path) {
+			matches, err := m.MatchArchive(path)
+			for _, match := range matches {
+				if match.Error != "" {
+					cb(match, fmt.Errorf("%v: %v", match.Entry, match.Error))
+					continue
+				}
+				cb(match, nil)
+			}
+			if err != nil {
+				cb(Match{Path: path}, err)
+			}
+			return nil
+		}
+		cb(m.MatchFile(path))
+		return nil
+	})
+}
@@ -0,0 +1,188 @@
+package match
+
+import (
+	"path/filepath"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/disc"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/serial"
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/sqlite"
+)
+
+// Track verification status
+const (
+	TrackOK      string = "ok"
+	TrackBad     string = "bad"
+	TrackMissing string = "missing"
+	TrackExtra   string = "extra"
+	// TrackUnknown is used when the disc has no known track list
+	TrackUnknown string = "unknown"
+)
+
+type TrackMatch struct {
+	Number int `json:"number"`
+	// Path is the local file, Filename the name of the dump's track
+	Path     string `json:"path,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Hashes   Hashes `json:"hashes"`
+	Status   string `json:"status"`
+}
+
+// MatchSheet hashes every file referenced by a .cue or .gdi sheet and reports
+// the disc as a single match. The disc is the TitleVariant most of the files
+// are a track of, each of its tracks is then verified by SHA1. When no track
+// list is known the first data track is matched like a plain image.
+func (m *Matcher) MatchSheet(path string) (Match, error) {
+	sheet, err := disc.OpenSheet(path)
+	if err != nil {
+		return Match{Path: path}, err
+	}
+
+	files := sheet.Files()
+	hashes := make([]Hashes, len(files))
+	readable := make([]bool, len(files))
+	for i, f := range files {
+		h, err := HashFile(f.Path)
+		if err != nil {
+			continue
+		}
+		hashes[i] = h
+		readable[i] = true
+	}
+
+	match, ok, err := m.matchDisc(path, files, hashes, readable)
+	if err != nil || ok {
+		return match, err
+	}
+	return m.matchSheetImage(sheet, files, hashes, readable)
+}
+
+// matchDisc finds the disc most of the tracks are a track of by SHA1 and
+// verifies each of its tracks, ok is false when no track is known.
+func (m *Matcher) matchDisc(path string, files []disc.Track, hashes []Hashes, readable []bool) (Match, bool, error) {
+	votes := make(map[int]int)
+	for i := range files {
+		if !readable[i] {
+			continue
+		}
+		tracks, err := sqlite.FindTitleVariantTracks(m.db, sqlite.ColumnSHA1, hashes[i].SHA1)
+		if err != nil {
+			return Match{Path: path}, false, err
+		}
+		seen := make(map[int]bool)
+		for _, t := range tracks {
+			if !seen[t.TitleVariantID] {
+				seen[t.TitleVariantID] = true
+				votes[t.TitleVariantID]++
+			}
+		}
+	}
+
+	discID := 0
+	for id, n := range votes {
+		if n > votes[discID] || (n == votes[discID] && id < discID) {
+			discID = id
+		}
+	}
+	if discID == 0 {
+		return Match{Path: path}, false, nil
+	}
+
+	tv, err := sqlite.GetTitleVariant(m.db, discID)
+	if err != nil {
+		return Match{Path: path}, false, err
+	}
+	expected, err := sqlite.GetTitleVariantTracks(m.db, discID)
+	if err != nil {
+		return Match{Path: path}, false, err
+	}
+
+	match := Match{
+		Path:     path,
+		Matched:  true,
+		MatchKey: KeyTracks,
+		Variant:  tv,
+		Tracks:   make([]TrackMatch, 0, len(expected)),
+	}
+	used := make([]bool, len(files))
+	for _, want := range expected {
+		tm := TrackMatch{Number: want.Number, Filename: want.Filename, Status: TrackMissing}
+		found := -1
+		for i := range files {
+			if !used[i] && readable[i] && hashes[i].SHA1 == want.SHA1 {
+				found = i
+				tm.Status = TrackOK
+				break
+			}
+		}
+		if found < 0 {
+			// same track number but different contents, or not readable
+			for i, f := range files {
+				if !used[i] && f.Number == want.Number {
+					found = i
+					if readable[i] {
+						tm.Status = TrackBad
+					}
+					break
+				}
+			}
+		}
+		if found >= 0 {
+			used[found] = true
+			tm.Path = files[found].Path
+			tm.Hashes = hashes[found]
+		}
+		match.Tracks = append(match.Tracks, tm)
+	}
+	for i, f := range files {
+		if used[i] {
+			continue
+		}
+		status := TrackExtra
+		if !readable[i] {
+			status = TrackMissing
+		}
+		match.Tracks = append(match.Tracks, TrackMatch{
+			Number: f.Number,
+			Path:   f.Path,
+			Hashes: hashes[i],
+			Status: status,
+		})
+	}
+	m.describe(&match)
+	return match, true, nil
+}
+
+func (m *Matcher) matchSheetImage(sheet disc.Sheet, files []disc.Track, hashes []Hashes, readable []bool) (Match, error) {
+	first := -1
+	for i, f := range files {
+		if readable[i] && (first < 0 || (f.Data && !files[first].Data)) {
+			first = i
+		}
+	}
+
+	match := Match{Path: sheet.Path}
+	if first >= 0 {
+		serials, _ := serial.FromImage(sheet.Path)
+		var err error
+		match, err = m.Lookup(hashes[first], serials, filepath.Base(files[first].Path))
+		match.Path = sheet.Path
+		if err != nil {
+			return match, err
+		}
+	}
+
+	match.Tracks = make([]TrackMatch, 0, len(files))
+	for i, f := range files {
+		status := TrackUnknown
+		if !readable[i] {
+			status = TrackMissing
+		}
+		match.Tracks = append(match.Tracks, TrackMatch{
+			Number: f.Number,
+			Path:   f.Path,
+			Hashes: hashes[i],
+			Status: status,
+		})
+	}
+	return match, nil
+}
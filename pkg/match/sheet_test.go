@@ -0,0 +1,124 @@
+package match
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCue = `FILE "Zzyzx Racer (USA) (Track 1).bin" BINARY
+  TRACK 01 MODE2/2352
+    INDEX 01 00:00:00
+FILE "Zzyzx Racer (USA) (Track 2).bin" BINARY
+  TRACK 02 AUDIO
+    INDEX 00 00:00:00
+    INDEX 01 00:02:00
+`
+
+// writeCueBin writes a cue sheet and its BIN files to dir, a nil BIN is left
+// out
+func writeCueBin(t *testing.T, dir string, bins [][]byte) string {
+	t.Helper()
+	names := []string{"Zzyzx Racer (USA) (Track 1).bin", "Zzyzx Racer (USA) (Track 2).bin"}
+	for i, bin := range bins {
+		if bin == nil {
+			continue
+		}
+		err := os.WriteFile(filepath.Join(dir, names[i]), bin, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "Zzyzx Racer (USA).cue")
+	err := os.WriteFile(path, []byte(testCue), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScanDirSheet(t *testing.T) {
+	disc := [][]byte{testBIN(10, 0x11), testBIN(6, 0x22)}
+	other := [][]byte{testBIN(10, 0x33), testBIN(6, 0x44)}
+	m := testMatcher(t, map[int][][]byte{1: disc, 2: other})
+
+	tests := []struct {
+		name   string
+		bins   [][]byte
+		status []string
+	}{
+		{"good dump", disc, []string{TrackOK, TrackOK}},
+		{"bad audio track", [][]byte{disc[0], testBIN(6, 0x55)}, []string{TrackOK, TrackBad}},
+		{"missing audio track", [][]byte{disc[0], nil}, []string{TrackOK, TrackMissing}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		cue := writeCueBin(t, dir, tt.bins)
+
+		matches := make([]Match, 0)
+		err := m.ScanDir(dir, func(match Match, err error) {
+			if err != nil {
+				t.Errorf("%v: %v: %v", tt.name, match.Path, err)
+			}
+			matches = append(matches, match)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the BIN files are only reported as tracks of the sheet
+		if len(matches) != 1 {
+			t.Fatalf("%v: %v matches, want 1", tt.name, len(matches))
+		}
+		match := matches[0]
+		if match.Path != cue || match.MatchKey != KeyTracks || match.Variant.ID != 1 {
+			t.Errorf("%v: %v matched variant %v by %q, want %v matched 1 by %q", tt.name, match.Path, match.Variant.ID, match.MatchKey, cue, KeyTracks)
+		}
+		if len(match.Tracks) != len(tt.status) {
+			t.Fatalf("%v: %v tracks, want %v", tt.name, len(match.Tracks), len(tt.status))
+		}
+		for i, tm := range match.Tracks {
+			if tm.Number != i+1 || tm.Status != tt.status[i] {
+				t.Errorf("%v: track %v is %v, want track %v %v", tt.name, tm.Number, tm.Status, i+1, tt.status[i])
+			}
+		}
+	}
+}
+
+func TestMatchTrackRows(t *testing.T) {
+	m := testMatcher(t, map[int][][]byte{
+		1: {testBIN(10, 0x11), testBIN(6, 0x22)},
+		2: {testBIN(10, 0x33), testBIN(7, 0x44)},
+		3: {testBIN(12, 0x55), testBIN(6, 0x66)},
+		4: {testBIN(12, 0x77), testBIN(6, 0x88)},
+	})
+	frames := func(n ...int64) []int64 {
+		sizes := make([]int64, len(n))
+		for i := range n {
+			sizes[i] = n[i] * 2352
+		}
+		return sizes
+	}
+
+	tests := []struct {
+		name  string
+		sizes []int64
+		id    int
+		ok    bool
+	}{
+		{"unique layout", frames(10, 6), 1, true},
+		{"same first track", frames(10, 7), 2, true},
+		{"extra track", frames(10, 6, 3), 0, false},
+		{"unknown layout", frames(11, 6), 0, false},
+		{"two discs with one layout", frames(12, 6), 0, false},
+	}
+	for _, tt := range tests {
+		tv, ok, err := m.matchTrackRows(tt.sizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok || tv.ID != tt.id {
+			t.Errorf("%v: matchTrackRows = %v, %v, want %v, %v", tt.name, tv.ID, ok, tt.id, tt.ok)
+		}
+	}
+}
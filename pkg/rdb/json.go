@@ -1,11 +1,12 @@
 package rdb
 
 import (
+	"bufio"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -33,31 +34,43 @@ type RdbJsonROM struct {
 	RDBName      string `json:"rbd_name"`
 	UniqueKey    string `json:"unique_key"`
 	UniqueType   string `json:"unique_type"`
+	// CloneOf is the parent game name from a DAT, RDBs don't have it
+	CloneOf string `json:"cloneof,omitempty"`
 }
 
-func MakeNDJSON(rdbFileName string) {
-	toolPath := "./libretrodb_tool"
-	rdbDir := "./assets/rdb"
-	ndjsonDir := "./assets/ndjson"
-	rdbPath := filepath.Join(rdbDir, rdbFileName)
-	ndjsonPath := filepath.Join(ndjsonDir, rdbFileName+".ndjson")
+func MakeNDJSON(rdbFileName string) error {
+	rdbPath := filepath.Join(settings.RdbDir, rdbFileName)
+	ndjsonPath := filepath.Join(settings.NdjsonDir, rdbFileName+".ndjson")
+
+	rf, err := OpenRDB(rdbPath)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
 	// open the out file for writing
 	outfile, err := os.Create(ndjsonPath)
 	if err != nil {
-		fmt.Println("Cannot create NDJSON", ndjsonPath, rdbFileName)
-		return
+		return err
 	}
 	defer outfile.Close()
 
-	cmd := exec.Command(toolPath, rdbPath, "list")
-	cmd.Stdout = outfile
-
-	err = cmd.Run()
-	if err != nil {
-		fmt.Println("Error running libretro_tool", rdbFileName)
-		fmt.Println(err)
-		return
+	w := bufio.NewWriter(outfile)
+	for {
+		rec, err := rf.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%v: %w", rdbFileName, err)
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+		w.WriteString("\n")
 	}
+	return w.Flush()
 }
 
 func LoadNDJSON(rdbName string) ([]RdbJsonROM, error) {
@@ -99,6 +112,20 @@ func ParseNDJSON(jsonStream []byte, rdbName string) ([]RdbJsonROM, error) {
 	return roms, nil
 }
 
+// EncodeSerial renders a plain text serial the way RDB binary serials are
+// stored in the NDJSON, as uppercase hex.
+func EncodeSerial(serial string) string {
+	return strings.ToUpper(hex.EncodeToString([]byte(serial)))
+}
+
+func DecodeSerial(serial string) string {
+	b, err := hex.DecodeString(serial)
+	if err != nil {
+		return serial
+	}
+	return string(b)
+}
+
 func MarshalRomJson(rom RdbJsonROM) (string, error) {
 	b, err := json.Marshal(rom)
 	if err != nil {
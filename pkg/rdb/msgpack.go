@@ -0,0 +1,219 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+Minimal MessagePack support covering the subset of types libretro's rmsgpack
+emits: nil, bool, ints, strings, binary, arrays and maps.
+*/
+
+// Binary is a msgpack bin value, kept distinct from strings so it can be
+// rendered as hex the same way libretrodb_tool does.
+type Binary []byte
+
+func readMsgpack(r *bufio.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return uint64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, uint64(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackUint(r, 1<<(b-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		buf, err := readMsgpackBytes(r, n)
+		return Binary(buf), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readMsgpackUint(r, 1<<(b-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n, err := readMsgpackUint(r, 1<<(b-0xd0))
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case 0xd0:
+			return int64(int8(n)), nil
+		case 0xd1:
+			return int64(int16(n)), nil
+		case 0xd2:
+			return int64(int32(n)), nil
+		}
+		return int64(n), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackUint(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readMsgpackUint(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := readMsgpackUint(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, int(n))
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", b)
+}
+
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// readMsgpackBytes reads n bytes without trusting n for the allocation, a
+// corrupt length fails at the end of the file instead of allocating up to 4GB
+func readMsgpackBytes(r *bufio.Reader, n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+func readMsgpackString(r *bufio.Reader, n uint64) (string, error) {
+	buf, err := readMsgpackBytes(r, n)
+	return string(buf), err
+}
+
+// readMsgpackArray and readMsgpackMap don't size by n either, every element
+// is at least a byte so a corrupt count runs out of file first
+func readMsgpackArray(r *bufio.Reader, n int) ([]any, error) {
+	arr := make([]any, 0)
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return arr, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n int) (map[string]any, error) {
+	m := make(map[string]any)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r)
+		if err != nil {
+			return m, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return m, fmt.Errorf("non string msgpack map key %v", k)
+		}
+		v, err := readMsgpack(r)
+		if err != nil {
+			return m, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func writeMsgpackNil(w io.Writer) error {
+	_, err := w.Write([]byte{0xc0})
+	return err
+}
+
+func writeMsgpackUint(w io.Writer, n uint64) error {
+	var buf []byte
+	switch {
+	case n <= 0x7f:
+		buf = []byte{byte(n)}
+	case n <= math.MaxUint8:
+		buf = []byte{0xcc, byte(n)}
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16([]byte{0xcd}, uint16(n))
+	case n <= math.MaxUint32:
+		buf = binary.BigEndian.AppendUint32([]byte{0xce}, uint32(n))
+	default:
+		buf = binary.BigEndian.AppendUint64([]byte{0xcf}, n)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeMsgpackString(w io.Writer, s string) error {
+	var buf []byte
+	n := len(s)
+	switch {
+	case n <= 0x1f:
+		buf = []byte{0xa0 | byte(n)}
+	case n <= math.MaxUint8:
+		buf = []byte{0xd9, byte(n)}
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16([]byte{0xda}, uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32([]byte{0xdb}, uint32(n))
+	}
+	buf = append(buf, s...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeMsgpackBinary(w io.Writer, b []byte) error {
+	var buf []byte
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf = []byte{0xc4, byte(n)}
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16([]byte{0xc5}, uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32([]byte{0xc6}, uint32(n))
+	}
+	buf = append(buf, b...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeMsgpackMapHeader(w io.Writer, n int) error {
+	var buf []byte
+	switch {
+	case n <= 0x0f:
+		buf = []byte{0x80 | byte(n)}
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16([]byte{0xde}, uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32([]byte{0xdf}, uint32(n))
+	}
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,40 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadMsgpackCorruptLength(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bin32", []byte{0xc6, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02}},
+		{"str32", []byte{0xdb, 0xff, 0xff, 0xff, 0xff, 'a', 'b'}},
+		{"bin8", []byte{0xc4, 0x10, 0x01}},
+		{"array32", []byte{0xdd, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"map32", []byte{0xdf, 0xff, 0xff, 0xff, 0xff, 0xa1, 'k'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readMsgpack(bufio.NewReader(bytes.NewReader(tt.data)))
+			if err != io.ErrUnexpectedEOF && err != io.EOF {
+				t.Errorf("readMsgpack = %v, want an EOF error", err)
+			}
+		})
+	}
+}
+
+func TestReadMsgpackBinary(t *testing.T) {
+	data := []byte{0xc4, 0x03, 0x01, 0x02, 0x03}
+	v, err := readMsgpack(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := v.(Binary); !ok || !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("readMsgpack = %#v, want Binary{1, 2, 3}", v)
+	}
+}
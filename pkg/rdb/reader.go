@@ -0,0 +1,238 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Native reader for libretrodb RDB files.
+
+Layout:
+	"RARCHDB\0"                 8 byte magic
+	uint64 big endian           offset of the metadata map
+	msgpack map * count         one document per record
+	msgpack nil                 end of records sentinel
+	msgpack map {"count": n}    metadata
+	index headers + entries     optional, written by libretrodb_tool create-index
+*/
+
+const rdbMagic = "RARCHDB\x00"
+
+const rdbHeaderSize = 16
+
+type RdbRecord map[string]any
+
+type RdbIndex struct {
+	Name    string
+	KeySize uint64
+	Count   uint64
+	Offset  int64
+}
+
+type RdbFile struct {
+	Count   uint64
+	Indexes []RdbIndex
+
+	f *os.File
+	r *bufio.Reader
+	// sentinelRead is set once the nil after the last record has been read
+	sentinelRead bool
+}
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strings.ToUpper(hex.EncodeToString(b)) + `"`), nil
+}
+
+func OpenRDB(rdbPath string) (*RdbFile, error) {
+	f, err := os.Open(rdbPath)
+	if err != nil {
+		return nil, err
+	}
+	rf := &RdbFile{f: f}
+	err = rf.readMetadata()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%v: %w", rdbPath, err)
+	}
+	_, err = f.Seek(rdbHeaderSize, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rf.r = bufio.NewReader(f)
+	return rf, nil
+}
+
+func (rf *RdbFile) readMetadata() error {
+	header := make([]byte, rdbHeaderSize)
+	if _, err := io.ReadFull(rf.f, header); err != nil {
+		return err
+	}
+	if string(header[:len(rdbMagic)]) != rdbMagic {
+		return errors.New("not a libretro RDB file")
+	}
+	metaOffset := int64(binary.BigEndian.Uint64(header[len(rdbMagic):]))
+
+	if _, err := rf.f.Seek(metaOffset, io.SeekStart); err != nil {
+		return err
+	}
+	cr := &countingReader{r: rf.f, n: metaOffset}
+	br := bufio.NewReader(cr)
+	meta, err := readMsgpack(br)
+	if err != nil {
+		return fmt.Errorf("reading metadata: %w", err)
+	}
+	metaMap, ok := meta.(map[string]any)
+	if !ok {
+		return errors.New("metadata is not a map")
+	}
+	rf.Count = asUint(metaMap["count"])
+
+	// Index headers follow the metadata, each one followed by `next` bytes
+	// of fixed size key/offset entries.
+	pos := cr.n - int64(br.Buffered())
+	for {
+		if _, err := rf.f.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		cr = &countingReader{r: rf.f, n: pos}
+		br = bufio.NewReader(cr)
+		v, err := readMsgpack(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading index header: %w", err)
+		}
+		idxMap, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		name, _ := idxMap["name"].(string)
+		idx := RdbIndex{
+			Name:    name,
+			KeySize: asUint(idxMap["key_size"]),
+			Offset:  cr.n - int64(br.Buffered()),
+		}
+		next := asUint(idxMap["next"])
+		if idx.KeySize > 0 {
+			idx.Count = next / (idx.KeySize + 8)
+		}
+		rf.Indexes = append(rf.Indexes, idx)
+		pos = idx.Offset + int64(next)
+	}
+	return nil
+}
+
+// Next returns the next record, or io.EOF after the end of records sentinel.
+func (rf *RdbFile) Next() (RdbRecord, error) {
+	if rf.sentinelRead {
+		return nil, io.EOF
+	}
+	v, err := readMsgpack(rf.r)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		rf.sentinelRead = true
+		return nil, io.EOF
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected record type %T", v)
+	}
+	return RdbRecord(m), nil
+}
+
+func (rf *RdbFile) Close() error {
+	return rf.f.Close()
+}
+
+func ReadRDB(rdbPath string) ([]RdbJsonROM, error) {
+	roms := make([]RdbJsonROM, 0)
+	rf, err := OpenRDB(rdbPath)
+	if err != nil {
+		return roms, err
+	}
+	defer rf.Close()
+	for {
+		rec, err := rf.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return roms, err
+		}
+		roms = append(roms, rec.ROM())
+	}
+	return roms, nil
+}
+
+// ROM maps the known RDB document keys onto an RdbJsonROM, binary fields are
+// rendered as uppercase hex to match libretrodb_tool output.
+func (rec RdbRecord) ROM() RdbJsonROM {
+	return RdbJsonROM{
+		Serial:       asString(rec["serial"]),
+		MD5:          asString(rec["md5"]),
+		SHA1:         asString(rec["sha1"]),
+		CRC:          asString(rec["crc"]),
+		Size:         int(asUint(rec["size"])),
+		RomName:      asString(rec["rom_name"]),
+		Region:       asString(rec["region"]),
+		Description:  asString(rec["description"]),
+		Name:         asString(rec["name"]),
+		Publisher:    asString(rec["publisher"]),
+		Developer:    asString(rec["developer"]),
+		ReleaseYear:  int(asUint(rec["releaseyear"])),
+		ReleaseMonth: int(asUint(rec["releasemonth"])),
+		Users:        int(asUint(rec["users"])),
+		Genre:        asString(rec["genre"]),
+		Franchise:    asString(rec["franchise"]),
+	}
+}
+
+func asString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case Binary:
+		return strings.ToUpper(hex.EncodeToString(t))
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	}
+	return ""
+}
+
+func asUint(v any) uint64 {
+	switch t := v.(type) {
+	case uint64:
+		return t
+	case int64:
+		if t > 0 {
+			return uint64(t)
+		}
+	case string:
+		n, _ := strconv.ParseUint(t, 10, 64)
+		return n
+	}
+	return 0
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,275 @@
+package rdb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testdata/fixture.rdb is built by hand, not by WriteRDB. It holds two
+// records followed by crc and sha1 index headers:
+//
+//	16   Test Game (USA)     crc, md5, sha1 as bin, serial as str, size uint16
+//	185  Other Game (Japan)  crc as str, serial as bin, size uint32
+const fixturePath = "testdata/fixture.rdb"
+
+func readFixture(t *testing.T) []RdbRecord {
+	t.Helper()
+	rf, err := OpenRDB(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	records := make([]RdbRecord, 0)
+	for {
+		rec, err := rf.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	// stays at EOF after the sentinel
+	if _, err := rf.Next(); err != io.EOF {
+		t.Errorf("Next after sentinel = %v, want io.EOF", err)
+	}
+	return records
+}
+
+func TestOpenRDBIndexes(t *testing.T) {
+	rf, err := OpenRDB(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	if rf.Count != 2 {
+		t.Errorf("Count = %v, want 2", rf.Count)
+	}
+	want := []RdbIndex{
+		{Name: "crc", KeySize: 4, Count: 1, Offset: 297},
+		{Name: "sha1", KeySize: 20, Count: 1, Offset: 336},
+	}
+	if !reflect.DeepEqual(rf.Indexes, want) {
+		t.Errorf("Indexes = %+v, want %+v", rf.Indexes, want)
+	}
+}
+
+func TestRecordROM(t *testing.T) {
+	records := readFixture(t)
+	want := []RdbJsonROM{
+		{
+			Name:        "Test Game (USA)",
+			Region:      "USA",
+			ReleaseYear: 1995,
+			Users:       2,
+			RomName:     "Test Game (USA).nes",
+			Size:        40976,
+			Serial:      "SLUS-00001",
+			CRC:         "3AD0AD4B",
+			MD5:         "00112233445566778899AABBCCDDEEFF",
+			SHA1:        "0123456789ABCDEF0123456789ABCDEF01234567",
+		},
+		{
+			Name:         "Other Game (Japan)",
+			ReleaseMonth: 3,
+			Size:         100000,
+			Serial:       "542D31323334",
+			CRC:          "DEADBEEF",
+		},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("read %v records, want %v", len(records), len(want))
+	}
+	for i, rec := range records {
+		if got := rec.ROM(); got != want[i] {
+			t.Errorf("record %v ROM() = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if _, ok := records[0]["crc"].(Binary); !ok {
+		t.Errorf("bin crc decoded as %T, want Binary", records[0]["crc"])
+	}
+	if _, ok := records[1]["crc"].(string); !ok {
+		t.Errorf("str crc decoded as %T, want string", records[1]["crc"])
+	}
+}
+
+func TestOpenRDBTruncated(t *testing.T) {
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"header", rdbHeaderSize - 1},
+		{"records", 200},
+		{"metadata", 265},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "truncated.rdb")
+			err := os.WriteFile(path, data[:tt.size], 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rf, err := OpenRDB(path)
+			if err == nil {
+				rf.Close()
+				t.Fatal("OpenRDB succeeded on a truncated file")
+			}
+		})
+	}
+}
+
+func TestOpenRDBBadMagic(t *testing.T) {
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'X'
+	path := filepath.Join(t.TempDir(), "bad.rdb")
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf, err := OpenRDB(path)
+	if err == nil {
+		rf.Close()
+		t.Fatal("OpenRDB succeeded without the RARCHDB magic")
+	}
+}
+
+func TestNextTruncatedRecord(t *testing.T) {
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keep the header and metadata, drop the end of the second record
+	path := filepath.Join(t.TempDir(), "truncated.rdb")
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf, err := OpenRDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	err = os.Truncate(path, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Next(); err != nil {
+		t.Fatalf("first record: %v", err)
+	}
+	if _, err := rf.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next on a truncated record = %v, want an error", err)
+	}
+}
+
+func TestWriteRDBRoundTrip(t *testing.T) {
+	roms := []RdbJsonROM{
+		{
+			Name:        "Test Game (USA)",
+			Description: "Test Game",
+			Region:      "USA",
+			Publisher:   "Publisher",
+			ReleaseYear: 1995,
+			Users:       2,
+			RomName:     "Test Game (USA).nes",
+			Size:        40976,
+			CRC:         "3AD0AD4B",
+			MD5:         "00112233445566778899AABBCCDDEEFF",
+			SHA1:        "0123456789ABCDEF0123456789ABCDEF01234567",
+		},
+		{
+			Name:   "Other Game (Japan)",
+			Size:   100000,
+			Serial: "SLPS-12345",
+			CRC:    "DEADBEEF",
+		},
+	}
+	path := filepath.Join(t.TempDir(), "roundtrip.rdb")
+	warnings, err := WriteRDB(path, roms, RdbIndexFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	got, err := ReadRDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, roms) {
+		t.Errorf("ReadRDB = %+v, want %+v", got, roms)
+	}
+
+	rf, err := OpenRDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if rf.Count != uint64(len(roms)) {
+		t.Errorf("Count = %v, want %v", rf.Count, len(roms))
+	}
+	// serial isn't hex so it is written as a string and not indexed
+	indexes := make(map[string]uint64)
+	for _, idx := range rf.Indexes {
+		indexes[idx.Name] = idx.Count
+	}
+	want := map[string]uint64{"crc": 2, "md5": 1, "sha1": 1}
+	if !reflect.DeepEqual(indexes, want) {
+		t.Errorf("index counts = %v, want %v", indexes, want)
+	}
+}
+
+func TestWriteRDBSerialIndex(t *testing.T) {
+	// serials are stored as the hex of their bytes and vary in length
+	roms := []RdbJsonROM{
+		{Name: "Long Serial (USA)", Serial: "534C55532D3030353934"},
+		{Name: "Short Serial (Japan)", Serial: "542D31323334"},
+	}
+	path := filepath.Join(t.TempDir(), "serial.rdb")
+	warnings, err := WriteRDB(path, roms, []string{"serial"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	rf, err := OpenRDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if len(rf.Indexes) != 1 {
+		t.Fatalf("Indexes = %+v, want one serial index", rf.Indexes)
+	}
+	idx := rf.Indexes[0]
+	if idx.Name != "serial" || idx.KeySize != 10 || idx.Count != 2 {
+		t.Errorf("index = %+v, want serial with key size 10 and 2 entries", idx)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys are sorted, the short serial is padded with zero bytes
+	want := []byte("SLUS-00594")
+	if got := data[idx.Offset : idx.Offset+10]; string(got) != string(want) {
+		t.Errorf("first key = %q, want %q", got, want)
+	}
+	want = []byte("T-1234\x00\x00\x00\x00")
+	if got := data[idx.Offset+18 : idx.Offset+28]; string(got) != string(want) {
+		t.Errorf("second key = %q, want %q", got, want)
+	}
+}
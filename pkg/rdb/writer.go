@@ -0,0 +1,214 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// RdbIndexFields are the indexes RetroArch can use for lookups, keys are
+// binary values padded to the longest one.
+var RdbIndexFields = []string{"crc", "md5", "sha1", "serial"}
+
+type rdbField struct {
+	Key   string
+	Value any
+}
+
+type rdbIndexEntry struct {
+	Key    []byte
+	Offset uint64
+}
+
+// WriteRDB writes roms as a libretrodb file. Indexes are built for each named
+// field from its binary values, shorter keys such as serials are padded with
+// zero bytes to the longest like libretro-db does and duplicate keys keep the
+// first record. Fields with values that can't be indexed are returned as
+// warnings.
+func WriteRDB(rdbPath string, roms []RdbJsonROM, indexes []string) ([]string, error) {
+	warnings := make([]string, 0)
+	outfile, err := os.Create(rdbPath)
+	if err != nil {
+		return warnings, err
+	}
+	defer outfile.Close()
+
+	cw := &countingWriter{w: bufio.NewWriter(outfile)}
+	// metadata offset is patched in once all records are written
+	cw.Write([]byte(rdbMagic))
+	cw.Write(make([]byte, 8))
+
+	entries := make(map[string][]rdbIndexEntry, len(indexes))
+	for _, rom := range roms {
+		offset := uint64(cw.n)
+		fields := romFields(rom)
+		err = writeRecord(cw, fields)
+		if err != nil {
+			return warnings, err
+		}
+		for _, field := range fields {
+			if b, ok := field.Value.(Binary); ok {
+				entries[field.Key] = append(entries[field.Key], rdbIndexEntry{Key: b, Offset: offset})
+			}
+		}
+	}
+	writeMsgpackNil(cw)
+
+	metaOffset := uint64(cw.n)
+	writeMsgpackMapHeader(cw, 1)
+	writeMsgpackString(cw, "count")
+	writeMsgpackUint(cw, uint64(len(roms)))
+
+	for _, name := range indexes {
+		if len(entries[name]) == 0 {
+			continue
+		}
+		idxEntries, warning := buildIndex(name, entries[name])
+		if warning != "" {
+			warnings = append(warnings, warning)
+			continue
+		}
+		keySize := uint64(len(idxEntries[0].Key))
+		writeMsgpackMapHeader(cw, 3)
+		writeMsgpackString(cw, "name")
+		writeMsgpackString(cw, name)
+		writeMsgpackString(cw, "key_size")
+		writeMsgpackUint(cw, keySize)
+		writeMsgpackString(cw, "next")
+		writeMsgpackUint(cw, uint64(len(idxEntries))*(keySize+8))
+		for _, entry := range idxEntries {
+			cw.Write(entry.Key)
+			cw.Write(binary.BigEndian.AppendUint64(nil, entry.Offset))
+		}
+	}
+
+	if cw.err != nil {
+		return warnings, cw.err
+	}
+	err = cw.w.(*bufio.Writer).Flush()
+	if err != nil {
+		return warnings, err
+	}
+	_, err = outfile.WriteAt(binary.BigEndian.AppendUint64(nil, metaOffset), int64(len(rdbMagic)))
+	return warnings, err
+}
+
+func buildIndex(name string, entries []rdbIndexEntry) ([]rdbIndexEntry, string) {
+	keySize := 0
+	for _, entry := range entries {
+		keySize = max(keySize, len(entry.Key))
+	}
+	if keySize == 0 {
+		return entries, fmt.Sprintf("index %v skipped, values are empty", name)
+	}
+	for i, entry := range entries {
+		if len(entry.Key) < keySize {
+			key := make([]byte, keySize)
+			copy(key, entry.Key)
+			entries[i].Key = key
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	unique := make([]rdbIndexEntry, 0, len(entries))
+	for i, entry := range entries {
+		if i > 0 && bytes.Equal(entry.Key, entries[i-1].Key) {
+			continue
+		}
+		unique = append(unique, entry)
+	}
+	return unique, ""
+}
+
+// romFields converts a rom back into RDB document fields, empty values are
+// omitted and hex hash/serial strings are written as binary as the upstream
+// dat converter does.
+func romFields(rom RdbJsonROM) []rdbField {
+	fields := make([]rdbField, 0, 16)
+	addString := func(key string, v string) {
+		if v != "" {
+			fields = append(fields, rdbField{key, v})
+		}
+	}
+	addUint := func(key string, v int) {
+		if v > 0 {
+			fields = append(fields, rdbField{key, uint64(v)})
+		}
+	}
+	addBinary := func(key string, v string) {
+		if v == "" {
+			return
+		}
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			fields = append(fields, rdbField{key, v})
+			return
+		}
+		fields = append(fields, rdbField{key, Binary(b)})
+	}
+
+	addString("name", rom.Name)
+	addString("description", rom.Description)
+	addString("genre", rom.Genre)
+	addString("franchise", rom.Franchise)
+	addString("developer", rom.Developer)
+	addString("publisher", rom.Publisher)
+	addString("region", rom.Region)
+	addUint("users", rom.Users)
+	addUint("releasemonth", rom.ReleaseMonth)
+	addUint("releaseyear", rom.ReleaseYear)
+	addString("rom_name", rom.RomName)
+	addUint("size", rom.Size)
+	addBinary("serial", rom.Serial)
+	addBinary("crc", rom.CRC)
+	addBinary("md5", rom.MD5)
+	addBinary("sha1", rom.SHA1)
+	return fields
+}
+
+func writeRecord(w io.Writer, fields []rdbField) error {
+	err := writeMsgpackMapHeader(w, len(fields))
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		err = writeMsgpackString(w, field.Key)
+		if err != nil {
+			return err
+		}
+		switch v := field.Value.(type) {
+		case string:
+			err = writeMsgpackString(w, v)
+		case uint64:
+			err = writeMsgpackUint(w, v)
+		case Binary:
+			err = writeMsgpackBinary(w, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,167 @@
+package rdb
+
+import "slices"
+
+/*
+Maps every RDB to the Zaparoo Core system ID its games launch under. Every
+name in RBDNames must be in exactly one of ZaparooSystemIDs and
+ZaparooUnsupported, the build fails otherwise. ZaparooUnsupported lists the
+RDBs Zaparoo Core has no system for yet, a deliberate choice and not a missing
+mapping. Several RDBs can share a Zaparoo system, e.g. every arcade RDB maps
+to Arcade.
+*/
+
+var ZaparooSystemIDs = map[string]string{
+	"Amstrad - CPC.rdb":                                  "Amstrad",
+	"Arduboy Inc - Arduboy.rdb":                          "Arduboy",
+	"Atari - 2600.rdb":                                   "Atari2600",
+	"Atari - 5200.rdb":                                   "Atari5200",
+	"Atari - 7800.rdb":                                   "Atari7800",
+	"Atari - 8-bit.rdb":                                  "Atari800",
+	"Atari - Jaguar.rdb":                                 "Jaguar",
+	"Atari - Lynx.rdb":                                   "AtariLynx",
+	"Atari - ST.rdb":                                     "AtariST",
+	"Atomiswave.rdb":                                     "Atomiswave",
+	"Bandai - WonderSwan Color.rdb":                      "WonderSwanColor",
+	"Bandai - WonderSwan.rdb":                            "WonderSwan",
+	"CHIP-8.rdb":                                         "Chip8",
+	"Casio - PV-1000.rdb":                                "CasioPV1000",
+	"Coleco - ColecoVision.rdb":                          "ColecoVision",
+	"Commodore - 64.rdb":                                 "C64",
+	"Commodore - Amiga.rdb":                              "Amiga",
+	"Commodore - CD32.rdb":                               "AmigaCD32",
+	"Commodore - PET.rdb":                                "PET2001",
+	"Commodore - Plus-4.rdb":                             "C16",
+	"Commodore - VIC-20.rdb":                             "VIC20",
+	"DOS.rdb":                                            "DOS",
+	"Emerson - Arcadia 2001.rdb":                         "Arcadia",
+	"Entex - Adventure Vision.rdb":                       "AdventureVision",
+	"FBNeo - Arcade Games.rdb":                           "Arcade",
+	"Fairchild - Channel F.rdb":                          "ChannelF",
+	"GCE - Vectrex.rdb":                                  "Vectrex",
+	"HBMAME.rdb":                                         "Arcade",
+	"MAME 2000.rdb":                                      "Arcade",
+	"MAME 2003-Plus.rdb":                                 "Arcade",
+	"MAME 2003.rdb":                                      "Arcade",
+	"MAME 2010.rdb":                                      "Arcade",
+	"MAME 2015.rdb":                                      "Arcade",
+	"MAME 2016.rdb":                                      "Arcade",
+	"MAME.rdb":                                           "Arcade",
+	"Magnavox - Odyssey2.rdb":                            "Odyssey2",
+	"Mattel - Intellivision.rdb":                         "Intellivision",
+	"Microsoft - MSX.rdb":                                "MSX",
+	"Microsoft - MSX2.rdb":                               "MSX",
+	"Microsoft - Xbox.rdb":                               "Xbox",
+	"Mobile - J2ME.rdb":                                  "J2ME",
+	"NEC - PC Engine - TurboGrafx 16.rdb":                "TurboGrafx16",
+	"NEC - PC Engine CD - TurboGrafx-CD.rdb":             "TurboGrafx16CD",
+	"NEC - PC Engine SuperGrafx.rdb":                     "SuperGrafx",
+	"NEC - PC-8001 - PC-8801.rdb":                        "PC88",
+	"NEC - PC-FX.rdb":                                    "PCFX",
+	"Nintendo - Family Computer Disk System.rdb":         "FDS",
+	"Nintendo - Game Boy Advance.rdb":                    "GBA",
+	"Nintendo - Game Boy Color.rdb":                      "GameboyColor",
+	"Nintendo - Game Boy.rdb":                            "Gameboy",
+	"Nintendo - GameCube.rdb":                            "GameCube",
+	"Nintendo - Nintendo 3DS.rdb":                        "3DS",
+	"Nintendo - Nintendo 64.rdb":                         "Nintendo64",
+	"Nintendo - Nintendo DS.rdb":                         "NDS",
+	"Nintendo - Nintendo DSi.rdb":                        "NDS",
+	"Nintendo - Nintendo Entertainment System.rdb":       "NES",
+	"Nintendo - Pokemon Mini.rdb":                        "PokemonMini",
+	"Nintendo - Satellaview.rdb":                         "SNES",
+	"Nintendo - Super Nintendo Entertainment System.rdb": "SNES",
+	"Nintendo - Virtual Boy.rdb":                         "VirtualBoy",
+	"Nintendo - Wii (Digital).rdb":                       "Wii",
+	"Nintendo - Wii.rdb":                                 "Wii",
+	"Philips - CD-i.rdb":                                 "CDI",
+	"SNK - Neo Geo CD.rdb":                               "NeoGeoCD",
+	"SNK - Neo Geo Pocket Color.rdb":                     "NeoGeoPocketColor",
+	"SNK - Neo Geo Pocket.rdb":                           "NeoGeoPocket",
+	"SNK - Neo Geo.rdb":                                  "NeoGeo",
+	"ScummVM.rdb":                                        "ScummVM",
+	"Sega - 32X.rdb":                                     "Sega32X",
+	"Sega - Dreamcast.rdb":                               "Dreamcast",
+	"Sega - Game Gear.rdb":                               "GameGear",
+	"Sega - Master System - Mark III.rdb":                "MasterSystem",
+	"Sega - Mega Drive - Genesis.rdb":                    "Genesis",
+	"Sega - Mega-CD - Sega CD.rdb":                       "MegaCD",
+	"Sega - Naomi 2.rdb":                                 "NAOMI2",
+	"Sega - Naomi.rdb":                                   "NAOMI",
+	"Sega - SG-1000.rdb":                                 "SG1000",
+	"Sega - Saturn.rdb":                                  "Saturn",
+	"Sharp - X68000.rdb":                                 "X68000",
+	"Sinclair - ZX 81.rdb":                               "ZX81",
+	"Sinclair - ZX Spectrum +3.rdb":                      "ZXSpectrum",
+	"Sinclair - ZX Spectrum.rdb":                         "ZXSpectrum",
+	"Sony - PlayStation 2.rdb":                           "PS2",
+	"Sony - PlayStation 3 (PSN).rdb":                     "PS3",
+	"Sony - PlayStation 3.rdb":                           "PS3",
+	"Sony - PlayStation Portable (PSN).rdb":              "PSP",
+	"Sony - PlayStation Portable.rdb":                    "PSP",
+	"Sony - PlayStation Vita.rdb":                        "Vita",
+	"Sony - PlayStation.rdb":                             "PSX",
+	"Spectravideo - SVI-318 - SVI-328.rdb":               "SVI328",
+	"The 3DO Company - 3DO.rdb":                          "3DO",
+	"Tiger - Game.com.rdb":                               "GameCom",
+	"VTech - CreatiVision.rdb":                           "CreatiVision",
+	"Watara - Supervision.rdb":                           "SuperVision",
+}
+
+var ZaparooUnsupported = []string{
+	"Amstrad - GX4000.rdb",
+	"Cannonball.rdb",
+	"Casio - Loopy.rdb",
+	"Cave Story.rdb",
+	"ChaiLove.rdb",
+	"Commodore - CDTV.rdb",
+	"DICE.rdb",
+	"DOOM.rdb",
+	"Dinothawr.rdb",
+	"Enterprise - 128.rdb",
+	"Epoch - Super Cassette Vision.rdb",
+	"Flashback.rdb",
+	"Funtech - Super Acan.rdb",
+	"GamePark - GP32.rdb",
+	"Handheld Electronic Game.rdb",
+	"Hartung - Game Master.rdb",
+	"Infocom - Z-Machine.rdb",
+	"Jump 'n Bump.rdb",
+	"LeapFrog - Leapster Learning Game System.rdb",
+	"LowRes NX.rdb",
+	"Lutro.rdb",
+	"MicroW8.rdb",
+	"MrBoom.rdb",
+	"NEC - PC-98.rdb",
+	"Nintendo - Nintendo 64DD.rdb",
+	"Nintendo - Sufami Turbo.rdb",
+	"Nintendo - e-Reader.rdb",
+	"PICO-8.rdb",
+	"Philips - Videopac+.rdb",
+	"PuzzleScript.rdb",
+	"Quake II.rdb",
+	"Quake III.rdb",
+	"Quake.rdb",
+	"RCA - Studio II.rdb",
+	"RPG Maker.rdb",
+	"Rick Dangerous.rdb",
+	"Sega - PICO.rdb",
+	"Sharp - X1.rdb",
+	"TIC-80.rdb",
+	"Thomson - MOTO.rdb",
+	"Tomb Raider.rdb",
+	"Uzebox.rdb",
+	"VTech - V.Smile.rdb",
+	"Vircon32.rdb",
+	"WASM-4.rdb",
+	"Wolfenstein 3D.rdb",
+}
+
+// ZaparooSystemID returns the Zaparoo system of an RDB, empty for unsupported
+// RDBs. ok is false when the RDB is in neither list.
+func ZaparooSystemID(name string) (string, bool) {
+	if id, ok := ZaparooSystemIDs[name]; ok {
+		return id, true
+	}
+	return "", slices.Contains(ZaparooUnsupported, name)
+}
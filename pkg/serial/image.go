@@ -0,0 +1,101 @@
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	sectorSize    = 2048
+	rawSectorSize = 2352
+	// maxDataSize caps reads of sizes taken from the image, the root
+	// directory and SYSTEM.CNF/UMD_DATA.BIN are a few sectors at most
+	maxDataSize = 64 * 1024
+)
+
+var rawSync = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// image reads 2048 byte user data sectors from either a cooked ISO or a raw
+// 2352 byte sector MODE1/MODE2 track.
+type image struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	dataOffset int64
+}
+
+func openImage(path string) (*image, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	img, err := newImage(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return img, f, nil
+}
+
+func newImage(r io.ReaderAt, size int64) (*image, error) {
+	img := &image{r: r, size: size, sectorSize: sectorSize}
+	head := make([]byte, 16)
+	_, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(head[:len(rawSync)], rawSync) {
+		img.sectorSize = rawSectorSize
+		switch head[15] {
+		case 1:
+			img.dataOffset = 16
+		case 2:
+			// MODE2 form 1, skip the 8 byte subheader
+			img.dataOffset = 24
+		default:
+			return nil, errors.New("unsupported raw sector mode")
+		}
+	}
+	return img, nil
+}
+
+func (img *image) readSector(lba int64) ([]byte, error) {
+	buf := make([]byte, sectorSize)
+	n, err := img.r.ReadAt(buf, lba*img.sectorSize+img.dataOffset)
+	if err != nil && !(err == io.EOF && n > 0) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readData reads length bytes of user data starting at a sector, crossing
+// sector boundaries for raw images. Lengths over maxDataSize are an error.
+func (img *image) readData(lba int64, length int64) ([]byte, error) {
+	if length < 0 || length > maxDataSize {
+		return nil, fmt.Errorf("data size %v over %v", length, maxDataSize)
+	}
+	data := make([]byte, 0, length)
+	for int64(len(data)) < length {
+		sector, err := img.readSector(lba)
+		if err != nil {
+			return data, err
+		}
+		if len(sector) == 0 {
+			break
+		}
+		data = append(data, sector...)
+		lba++
+	}
+	if int64(len(data)) > length {
+		data = data[:length]
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package serial
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+type isoFile struct {
+	Name string
+	LBA  int64
+	Size int64
+}
+
+// readRootDir lists the root directory of an ISO9660 filesystem, file
+// versions (";1") are stripped from names.
+func (img *image) readRootDir() ([]isoFile, error) {
+	pvd, err := img.readSector(16)
+	if err != nil {
+		return nil, err
+	}
+	if len(pvd) < 190 || pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return nil, errors.New("no ISO9660 primary volume descriptor")
+	}
+	root := pvd[156 : 156+34]
+	rootLBA := int64(binary.LittleEndian.Uint32(root[2:6]))
+	rootSize := int64(binary.LittleEndian.Uint32(root[10:14]))
+
+	dir, err := img.readData(rootLBA, rootSize)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]isoFile, 0)
+	pos := 0
+	for pos < len(dir) {
+		recLen := int(dir[pos])
+		if recLen == 0 {
+			// records don't span sectors, skip to the next one
+			pos = (pos/sectorSize + 1) * sectorSize
+			continue
+		}
+		if pos+recLen > len(dir) || recLen < 34 {
+			break
+		}
+		rec := dir[pos : pos+recLen]
+		nameLen := int(rec[32])
+		if 33+nameLen <= len(rec) {
+			name := string(rec[33 : 33+nameLen])
+			name, _, _ = strings.Cut(name, ";")
+			files = append(files, isoFile{
+				Name: name,
+				LBA:  int64(binary.LittleEndian.Uint32(rec[2:6])),
+				Size: int64(binary.LittleEndian.Uint32(rec[10:14])),
+			})
+		}
+		pos += recLen
+	}
+	return files, nil
+}
+
+func (img *image) readRootFile(name string) ([]byte, error) {
+	files, err := img.readRootDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.EqualFold(f.Name, name) {
+			return img.readData(f.LBA, f.Size)
+		}
+	}
+	return nil, errors.New("file not found " + name)
+}
@@ -0,0 +1,41 @@
+package serial
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testISO is a cooked image with a primary volume descriptor whose root
+// directory record claims rootSize bytes at sector 18
+func testISO(rootSize uint32) []byte {
+	iso := make([]byte, 20*sectorSize)
+	pvd := iso[16*sectorSize:]
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	root := pvd[156 : 156+34]
+	root[0] = 34
+	binary.LittleEndian.PutUint32(root[2:6], 18)
+	binary.LittleEndian.PutUint32(root[10:14], rootSize)
+	return iso
+}
+
+func TestReadRootDirSize(t *testing.T) {
+	img, err := newImage(bytes.NewReader(testISO(sectorSize)), 20*sectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = img.readRootDir()
+	if err != nil {
+		t.Errorf("readRootDir = %v, want no error", err)
+	}
+
+	img, err = newImage(bytes.NewReader(testISO(0xffffffff)), 20*sectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = img.readRootDir()
+	if err == nil {
+		t.Error("readRootDir of a 4 GiB root directory, want an error")
+	}
+}
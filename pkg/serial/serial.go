@@ -0,0 +1,171 @@
+package serial
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/disc"
+)
+
+/*
+Extracts product serials from disc images so TitleVariants can be matched by
+Serial. Candidates are returned in the formats libretro databases use, most
+specific first, callers should try each in turn.
+*/
+
+const (
+	gameCubeMagic uint32 = 0xC2339F3D
+	wiiMagic      uint32 = 0x5D1C9EA3
+)
+
+var bootLine = regexp.MustCompile(`(?m)^\s*BOOT2?\s*=\s*cdrom0?:\\?([^;\s]+)`)
+
+// gameCubeRegions maps the region letter of a disc ID to the suffix used in
+// DL-DOL style serials
+var gameCubeRegions = map[byte]string{
+	'D': "NOE",
+	'E': "USA",
+	'F': "FRA",
+	'H': "HOL",
+	'I': "ITA",
+	'J': "JPN",
+	'K': "KOR",
+	'P': "EUR",
+	'S': "ESP",
+	'U': "AUS",
+}
+
+func IsImage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".iso", ".bin", ".img", ".cue", ".gdi", ".gcm":
+		return true
+	}
+	return false
+}
+
+func FromImage(path string) ([]string, error) {
+	if disc.IsSheet(path) {
+		return fromSheet(path)
+	}
+	img, f, err := openImage(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return fromDiscImage(img)
+}
+
+func FromReader(r io.ReaderAt, size int64) ([]string, error) {
+	img, err := newImage(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return fromDiscImage(img)
+}
+
+func fromDiscImage(img *image) ([]string, error) {
+	if img.sectorSize == sectorSize {
+		if serials := gameCubeSerials(img.r); len(serials) > 0 {
+			return serials, nil
+		}
+	}
+
+	sector0, err := img.readSector(0)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(sector0, []byte("SEGA SEGASATURN ")):
+		return nonEmpty(headerField(sector0, 0x20, 10)), nil
+	case bytes.HasPrefix(sector0, []byte("SEGA SEGAKATANA ")):
+		return nonEmpty(headerField(sector0, 0x40, 10)), nil
+	case bytes.HasPrefix(sector0, []byte("SEGADISCSYSTEM  ")):
+		return segaCDSerials(headerField(sector0, 0x180, 14)), nil
+	}
+
+	if cnf, err := img.readRootFile("SYSTEM.CNF"); err == nil {
+		if m := bootLine.FindSubmatch(cnf); m != nil {
+			return playStationSerials(string(m[1])), nil
+		}
+	}
+	if umd, err := img.readRootFile("UMD_DATA.BIN"); err == nil {
+		id, _, _ := strings.Cut(string(umd), "|")
+		return nonEmpty(strings.TrimSpace(id)), nil
+	}
+	return nil, errors.New("no serial found")
+}
+
+func headerField(sector []byte, offset int, length int) string {
+	if len(sector) < offset+length {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.Trim(sector[offset:offset+length], "\x00")))
+}
+
+func nonEmpty(serials ...string) []string {
+	result := make([]string, 0, len(serials))
+	for _, s := range serials {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// playStationSerials turns a boot file such as SLUS_005.94 into SLUS-00594
+func playStationSerials(bootFile string) []string {
+	if i := strings.LastIndexAny(bootFile, `\/`); i >= 0 {
+		bootFile = bootFile[i+1:]
+	}
+	bootFile = strings.ToUpper(bootFile)
+	serial := strings.ReplaceAll(strings.ReplaceAll(bootFile, "_", "-"), ".", "")
+	return nonEmpty(serial, bootFile)
+}
+
+// segaCDSerials parses the "GM T-45034 -00" product field, the revision
+// suffix is kept as a second candidate
+func segaCDSerials(field string) []string {
+	field = strings.TrimSpace(strings.TrimPrefix(field, "GM"))
+	base := field
+	if i := strings.LastIndex(field, "-"); i > 0 && len(field)-i == 3 {
+		base = strings.TrimSpace(field[:i])
+	}
+	base = strings.ReplaceAll(base, " ", "")
+	return nonEmpty(base, strings.ReplaceAll(field, " ", ""))
+}
+
+func gameCubeSerials(r io.ReaderAt) []string {
+	header := make([]byte, 0x20)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil
+	}
+	if binary.BigEndian.Uint32(header[0x1c:]) != gameCubeMagic && binary.BigEndian.Uint32(header[0x18:]) != wiiMagic {
+		return nil
+	}
+	id := string(header[:6])
+	serials := []string{id, id[:4]}
+	if region, ok := gameCubeRegions[id[3]]; ok {
+		serials = append(serials, "DL-DOL-"+id[:4]+"-"+region)
+	}
+	return serials
+}
+
+// fromSheet tries each data track of a cue or gdi sheet in order
+func fromSheet(sheetPath string) ([]string, error) {
+	sheet, err := disc.OpenSheet(sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, dataFile := range sheet.DataFiles() {
+		serials, err := FromImage(dataFile)
+		if err == nil && len(serials) > 0 {
+			return serials, nil
+		}
+	}
+	return nil, errors.New("no serial found")
+}
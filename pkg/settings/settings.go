@@ -3,8 +3,12 @@ package settings
 const (
 	DBJsonDir          string = "./db"
 	RdbDir             string = "./assets/rdb"
+	RdbBuildDir        string = "./assets/rdbbuild"
+	DatDir             string = "./assets/dat"
+	DatBuildDir        string = "./assets/datbuild"
 	NdjsonDir          string = "./assets/ndjson"
 	SqliteDir          string = "./assets/sqlite"
 	DBSqliteUniquePath string = "./assets/sqlite/uniqueindex.sqlite"
 	DBPath             string = "./assets/sqlite/zaparoo-titles-database.sqlite"
+	ManifestPath       string = "./assets/SHA256SUMS"
 )
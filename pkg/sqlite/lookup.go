@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+const titleVariantRecordQuery = `
+	SELECT
+	TitleVariants.ID, IFNULL(TitleVariants.TitleID, 0), TitleVariants.SystemID, TitleVariants.Filename,
+	TitleVariants.ReleaseYear, TitleVariants.ReleaseMonth, TitleVariants.Users,
+	IFNULL(TitleVariants.RegionID, 0), IFNULL(TitleVariants.PublisherID, 0), IFNULL(TitleVariants.DeveloperID, 0),
+	IFNULL(TitleVariants.GenreID, 0), IFNULL(TitleVariants.FranchiseID, 0), IFNULL(TitleVariants.ExtensionID, 0),
+	IFNULL(TitleVariants.UniqueTypeID, 0), TitleVariants.Serial, TitleVariants.MD5, TitleVariants.SHA1,
+	TitleVariants.CRC, TitleVariants.Size, TitleVariants.Name, TitleVariants.Description,
+	IFNULL(TitleVariants.ParentVariantID, 0), TitleVariants.Version, TitleVariants.Revision,
+	IFNULL(Titles.Name, ''), IFNULL(Titles.WorkID, 0), IFNULL(Works.Name, ''),
+	Systems.ID, Systems.Name, Systems.ZaparooSystemID, Systems.Description,
+	IFNULL(Regions.Name, ''), IFNULL((
+		SELECT group_concat(Name, ',') FROM (
+			SELECT Regions.Name FROM TitleVariantRegions
+			JOIN Regions ON Regions.ID = TitleVariantRegions.RegionID
+			WHERE TitleVariantRegions.TitleVariantID = TitleVariants.ID
+			ORDER BY Regions.Name
+		)
+	), ''), IFNULL((
+		SELECT group_concat(Name, ',') FROM (
+			SELECT Languages.Name FROM TitleVariantLanguages
+			JOIN Languages ON Languages.ID = TitleVariantLanguages.LanguageID
+			WHERE TitleVariantLanguages.TitleVariantID = TitleVariants.ID
+			ORDER BY Languages.Name
+		)
+	), ''),
+	IFNULL(Publishers.Name, ''), IFNULL(Developers.Name, ''),
+	IFNULL(Genres.Name, ''), IFNULL(Franchises.Name, '')
+	FROM TitleVariants
+	JOIN Systems ON Systems.ID = TitleVariants.SystemID
+	LEFT JOIN Titles ON Titles.ID = TitleVariants.TitleID
+	LEFT JOIN Works ON Works.ID = Titles.WorkID
+	LEFT JOIN Regions ON Regions.ID = TitleVariants.RegionID
+	LEFT JOIN Publishers ON Publishers.ID = TitleVariants.PublisherID
+	LEFT JOIN Developers ON Developers.ID = TitleVariants.DeveloperID
+	LEFT JOIN Genres ON Genres.ID = TitleVariants.GenreID
+	LEFT JOIN Franchises ON Franchises.ID = TitleVariants.FranchiseID
+`
+
+// OpenZTDBReadOnly opens a published database without ever writing to it
+func OpenZTDBReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	uri := url.URL{Scheme: "file", Opaque: url.PathEscape(path), RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite3", uri.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func scanTitleVariantRecords(rows *sql.Rows) ([]ztdb.TitleVariantRecord, error) {
+	results := make([]ztdb.TitleVariantRecord, 0)
+	defer rows.Close()
+	for rows.Next() {
+		r := ztdb.TitleVariantRecord{}
+		s := &r.Variant
+		var regions, languages string
+		err := rows.Scan(
+			&s.ID, &s.TitleID, &s.SystemID, &s.Filename, &s.ReleaseYear, &s.ReleaseMonth, &s.Users, &s.RegionID, &s.PublisherID, &s.DeveloperID,
+			&s.GenreID, &s.FranchiseID, &s.ExtensionID, &s.UniqueTypeID, &s.Serial, &s.MD5, &s.SHA1, &s.CRC, &s.Size, &s.Name, &s.Description,
+			&s.ParentVariantID, &s.Version, &s.Revision,
+			&r.Title, &r.WorkID, &r.Work,
+			&r.System.ID, &r.System.Name, &r.System.ZaparooSystemID, &r.System.Description,
+			&r.Region, &regions, &languages, &r.Publisher, &r.Developer, &r.Genre, &r.Franchise,
+		)
+		if err != nil {
+			return results, err
+		}
+		r.Regions = make([]string, 0)
+		if regions != "" {
+			r.Regions = strings.Split(regions, ",")
+		}
+		r.Languages = make([]string, 0)
+		if languages != "" {
+			r.Languages = strings.Split(languages, ",")
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// RecordFilter narrows a record lookup, zero values don't filter
+type RecordFilter struct {
+	TitleID  int
+	SystemID int
+	// ZaparooSystemID matches every system mapped to the Zaparoo Core system
+	ZaparooSystemID string
+	// Size matches variants of this size and variants without a known size
+	Size int64
+}
+
+// FindTitleVariantRecords looks up joined TitleVariants by a match column
+func FindTitleVariantRecords(db *sql.DB, column string, value string, filter RecordFilter) ([]ztdb.TitleVariantRecord, error) {
+	switch column {
+	case ColumnSHA1, ColumnMD5, ColumnCRC, ColumnSerial, ColumnFilename:
+	default:
+		return nil, fmt.Errorf("unsupported TitleVariants lookup column %v", column)
+	}
+	rows, err := db.Query(titleVariantRecordQuery+`
+		WHERE TitleVariants.`+column+` = ?
+		AND (? = 0 OR TitleVariants.TitleID = ?)
+		AND (? = 0 OR TitleVariants.SystemID = ?)
+		AND (? = '' OR Systems.ZaparooSystemID = ?)
+		AND (? = 0 OR TitleVariants.Size = 0 OR TitleVariants.Size = ?)
+		ORDER BY TitleVariants.ID;
+	`, value, filter.TitleID, filter.TitleID, filter.SystemID, filter.SystemID, filter.ZaparooSystemID, filter.ZaparooSystemID, filter.Size, filter.Size)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantRecords(rows)
+}
+
+func FindTitleVariantRecordsByTitleID(db *sql.DB, titleID int) ([]ztdb.TitleVariantRecord, error) {
+	rows, err := db.Query(titleVariantRecordQuery+`
+		WHERE TitleVariants.TitleID = ?
+		ORDER BY TitleVariants.SystemID, TitleVariants.ID;
+	`, titleID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantRecords(rows)
+}
+
+// FindTitleVariantRecordsByWorkID returns every variant of every title of a
+// work, grouped by system
+func FindTitleVariantRecordsByWorkID(db *sql.DB, workID int) ([]ztdb.TitleVariantRecord, error) {
+	rows, err := db.Query(titleVariantRecordQuery+`
+		WHERE Titles.WorkID = ?
+		ORDER BY TitleVariants.SystemID, TitleVariants.ID;
+	`, workID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantRecords(rows)
+}
+
+// FindTitleVariantRecordsInRegions returns the variants released in any of
+// regionIDs, ordered by ID
+func FindTitleVariantRecordsInRegions(db *sql.DB, regionIDs []int, filter RecordFilter) ([]ztdb.TitleVariantRecord, error) {
+	if len(regionIDs) == 0 {
+		return []ztdb.TitleVariantRecord{}, nil
+	}
+	args := make([]any, 0, len(regionIDs)+7)
+	for _, id := range regionIDs {
+		args = append(args, id)
+	}
+	args = append(args, filter.TitleID, filter.TitleID, filter.SystemID, filter.SystemID,
+		filter.ZaparooSystemID, filter.ZaparooSystemID, filter.Size, filter.Size)
+	rows, err := db.Query(titleVariantRecordQuery+`
+		WHERE TitleVariants.ID IN (
+			SELECT TitleVariantID FROM TitleVariantRegions
+			WHERE RegionID IN (?`+strings.Repeat(", ?", len(regionIDs)-1)+`)
+		)
+		AND (? = 0 OR TitleVariants.TitleID = ?)
+		AND (? = 0 OR TitleVariants.SystemID = ?)
+		AND (? = '' OR Systems.ZaparooSystemID = ?)
+		AND (? = 0 OR TitleVariants.Size = 0 OR TitleVariants.Size = ?)
+		ORDER BY TitleVariants.ID;
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantRecords(rows)
+}
@@ -0,0 +1,243 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+const titleVariantColumns = `
+	ID, IFNULL(TitleID, 0), SystemID, Filename, ReleaseYear, ReleaseMonth, Users,
+	IFNULL(RegionID, 0), IFNULL(PublisherID, 0), IFNULL(DeveloperID, 0), IFNULL(GenreID, 0),
+	IFNULL(FranchiseID, 0), IFNULL(ExtensionID, 0), IFNULL(UniqueTypeID, 0),
+	Serial, MD5, SHA1, CRC, Size, Name, Description, IFNULL(ParentVariantID, 0), Version, Revision
+`
+
+// Columns TitleVariants can be looked up by, in match priority order
+const (
+	ColumnSHA1     string = "SHA1"
+	ColumnMD5      string = "MD5"
+	ColumnCRC      string = "CRC"
+	ColumnSerial   string = "Serial"
+	ColumnFilename string = "Filename"
+)
+
+func scanTitleVariants(rows *sql.Rows) ([]ztdb.TitleVariant, error) {
+	results := make([]ztdb.TitleVariant, 0)
+	defer rows.Close()
+	for rows.Next() {
+		s := ztdb.TitleVariant{}
+		err := rows.Scan(
+			&s.ID, &s.TitleID, &s.SystemID, &s.Filename, &s.ReleaseYear, &s.ReleaseMonth, &s.Users, &s.RegionID, &s.PublisherID, &s.DeveloperID,
+			&s.GenreID, &s.FranchiseID, &s.ExtensionID, &s.UniqueTypeID, &s.Serial, &s.MD5, &s.SHA1, &s.CRC, &s.Size, &s.Name, &s.Description,
+			&s.ParentVariantID, &s.Version, &s.Revision,
+		)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+func findTitleVariantsQuery(column string) (string, error) {
+	switch column {
+	case ColumnSHA1, ColumnMD5, ColumnCRC, ColumnSerial, ColumnFilename:
+	default:
+		return "", fmt.Errorf("unsupported TitleVariants lookup column %v", column)
+	}
+	return `
+		SELECT` + titleVariantColumns + `
+		FROM TitleVariants
+		WHERE ` + column + ` = ?
+		ORDER BY ID;
+	`, nil
+}
+
+// FindTitleVariantsOnSystem is FindTitleVariants limited to one system, for
+// keys such as filenames that are only unique within a system
+func FindTitleVariantsOnSystem(db *sql.DB, column string, value string, systemID int) ([]ztdb.TitleVariant, error) {
+	query, err := findTitleVariantsQuery(column)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.Replace(query, "= ?", "= ? AND SystemID = ?", 1)
+	rows, err := db.Query(query, value, systemID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariants(rows)
+}
+
+func FindTitleVariants(db *sql.DB, column string, value string) ([]ztdb.TitleVariant, error) {
+	query, err := findTitleVariantsQuery(column)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, value)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariants(rows)
+}
+
+// ExplainFindTitleVariants returns the query plan of a FindTitleVariants
+// lookup, one line per step
+func ExplainFindTitleVariants(db *sql.DB, column string) ([]string, error) {
+	query, err := findTitleVariantsQuery(column)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`EXPLAIN QUERY PLAN `+query, "")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plan := make([]string, 0)
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return plan, err
+		}
+		plan = append(plan, detail)
+	}
+	return plan, rows.Err()
+}
+
+// SampleTitleVariants returns up to n random TitleVariants
+func SampleTitleVariants(db *sql.DB, n int) ([]ztdb.TitleVariant, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`
+		FROM TitleVariants
+		ORDER BY random()
+		LIMIT ?;
+	`, n)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariants(rows)
+}
+
+func GetMetaName(db *sql.DB, table string, id int) (string, error) {
+	var name string
+	err := db.QueryRow(`
+		SELECT
+		Name
+		FROM `+table+`
+		WHERE ID = ?;
+	`, id).Scan(&name)
+	return name, err
+}
+
+func FindTitleVariantsBySize(db *sql.DB, size int64) ([]ztdb.TitleVariant, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`
+		FROM TitleVariants
+		WHERE Size = ?
+		ORDER BY ID;
+	`, size)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariants(rows)
+}
+
+// FindTitleVariantsByFilenamePrefix uses a range so the (SystemID, Filename)
+// index applies, U+10FFFF sorts after every other character.
+func FindTitleVariantsByFilenamePrefix(db *sql.DB, systemID int, prefix string) ([]ztdb.TitleVariant, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`
+		FROM TitleVariants
+		WHERE SystemID = ? AND Filename >= ? AND Filename < ?
+		ORDER BY Filename, ID;
+	`, systemID, prefix, prefix+string(utf8.MaxRune))
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariants(rows)
+}
+
+func GetTitleVariant(db *sql.DB, id int) (ztdb.TitleVariant, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`
+		FROM TitleVariants
+		WHERE ID = ?;
+	`, id)
+	if err != nil {
+		return ztdb.TitleVariant{}, err
+	}
+	tvs, err := scanTitleVariants(rows)
+	if err != nil {
+		return ztdb.TitleVariant{}, err
+	}
+	if len(tvs) == 0 {
+		return ztdb.TitleVariant{}, sql.ErrNoRows
+	}
+	return tvs[0], nil
+}
+
+const titleVariantTrackColumns = `
+	ID, TitleVariantID, Number, Filename, MD5, SHA1, CRC, Size
+`
+
+func scanTitleVariantTracks(rows *sql.Rows) ([]ztdb.TitleVariantTrack, error) {
+	results := make([]ztdb.TitleVariantTrack, 0)
+	defer rows.Close()
+	for rows.Next() {
+		t := ztdb.TitleVariantTrack{}
+		err := rows.Scan(&t.ID, &t.TitleVariantID, &t.Number, &t.Filename, &t.MD5, &t.SHA1, &t.CRC, &t.Size)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, t)
+	}
+	return results, rows.Err()
+}
+
+func FindTitleVariantTracks(db *sql.DB, column string, value string) ([]ztdb.TitleVariantTrack, error) {
+	switch column {
+	case ColumnSHA1, ColumnMD5, ColumnCRC, ColumnFilename:
+	default:
+		return nil, fmt.Errorf("unsupported TitleVariantTracks lookup column %v", column)
+	}
+	rows, err := db.Query(`
+		SELECT`+titleVariantTrackColumns+`
+		FROM TitleVariantTracks
+		WHERE `+column+` = ?
+		ORDER BY ID;
+	`, value)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantTracks(rows)
+}
+
+func FindTitleVariantTracksBySize(db *sql.DB, number int, size int64) ([]ztdb.TitleVariantTrack, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantTrackColumns+`
+		FROM TitleVariantTracks
+		WHERE Number = ? AND Size = ?
+		ORDER BY ID;
+	`, number, size)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantTracks(rows)
+}
+
+func GetTitleVariantTracks(db *sql.DB, titleVariantID int) ([]ztdb.TitleVariantTrack, error) {
+	rows, err := db.Query(`
+		SELECT`+titleVariantTrackColumns+`
+		FROM TitleVariantTracks
+		WHERE TitleVariantID = ?
+		ORDER BY Number, ID;
+	`, titleVariantID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTitleVariantTracks(rows)
+}
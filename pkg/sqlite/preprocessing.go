@@ -3,6 +3,8 @@ package sqlite
 import (
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
 	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
@@ -10,17 +12,22 @@ import (
 )
 
 const (
-	TableSystem        string = "Systems"
-	TableRegion        string = "Regions"
-	TableLanguage      string = "Languages"
-	TablePublisher     string = "Publishers"
-	TableDeveloper     string = "Developers"
-	TableGenre         string = "Genres"
-	TableFranchise     string = "Franchises"
-	TableFileExtension string = "FileExtensions"
-	TableUniqueType    string = "UniqueTypes"
-	TableTitle         string = "Titles"
-	TableTitleVariant  string = "TitleVariants"
+	TableSystem               string = "Systems"
+	TableRegion               string = "Regions"
+	TableRegionAlias          string = "RegionAliases"
+	TableLanguage             string = "Languages"
+	TablePublisher            string = "Publishers"
+	TableDeveloper            string = "Developers"
+	TableGenre                string = "Genres"
+	TableFranchise            string = "Franchises"
+	TableFileExtension        string = "FileExtensions"
+	TableUniqueType           string = "UniqueTypes"
+	TableWork                 string = "Works"
+	TableTitle                string = "Titles"
+	TableTitleVariant         string = "TitleVariants"
+	TableTitleVariantTrack    string = "TitleVariantTracks"
+	TableTitleVariantLanguage string = "TitleVariantLanguages"
+	TableTitleVariantRegion   string = "TitleVariantRegions"
 )
 
 func OpenVariantIndexDB() (*sql.DB, error) {
@@ -123,22 +130,152 @@ func GetJsonIndexRow(db *sql.DB, id int) (JsonIndexRow, error) {
 	return row, err
 }
 
+func OpenZTDB() (*sql.DB, error) {
+	return sql.Open("sqlite3", settings.DBPath)
+}
+
+func GetZTDBInfo(db *sql.DB) (ztdb.ZTDBInfo, error) {
+	var info ztdb.ZTDBInfo
+	err := db.QueryRow(`
+		SELECT
+		Version, Description, Date
+		FROM ZTDBInfo;
+	`).Scan(&info.Version, &info.Description, &info.Date)
+	return info, err
+}
+
+func SetZTDBInfo(db *sql.DB, info ztdb.ZTDBInfo) error {
+	_, err := db.Exec(`
+		UPDATE ZTDBInfo
+		SET Version = ?, Description = ?, Date = ?;
+	`, info.Version, info.Description, info.Date)
+	return err
+}
+
+func GetSystems(db *sql.DB) ([]ztdb.System, error) {
+	var results []ztdb.System
+	rows, err := db.Query(`
+		SELECT
+		ID, Name, ZaparooSystemID, Description
+		FROM Systems
+		ORDER BY ID;
+	`)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		s := ztdb.System{}
+		err := rows.Scan(&s.ID, &s.Name, &s.ZaparooSystemID, &s.Description)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+// GetRegions returns every region with its aliases
+func GetRegions(db *sql.DB) ([]ztdb.Region, error) {
+	results := make([]ztdb.Region, 0)
+	rows, err := db.Query(`
+		SELECT
+		ID, Name, Description, ISOCode, IFNULL(ParentRegionID, 0), IFNULL((
+			SELECT group_concat(Alias, ',') FROM (
+				SELECT Alias FROM RegionAliases
+				WHERE RegionAliases.RegionID = Regions.ID
+				ORDER BY Alias
+			)
+		), '')
+		FROM Regions
+		ORDER BY ID;
+	`)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := ztdb.Region{}
+		var aliases string
+		err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.ISOCode, &r.ParentRegionID, &aliases)
+		if err != nil {
+			return results, err
+		}
+		if aliases != "" {
+			r.Aliases = strings.Split(aliases, ",")
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// GetRegionID finds a region by name, ISO 3166 code or alias, ignoring case
+func GetRegionID(db *sql.DB, name string) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		SELECT ID FROM Regions
+		WHERE Name = ?1 COLLATE NOCASE OR ISOCode = ?1 COLLATE NOCASE
+		UNION ALL
+		SELECT RegionID FROM RegionAliases
+		WHERE Alias = ?1
+		LIMIT 1;
+	`, name).Scan(&id)
+	return id, err
+}
+
+// GetGenericMeta returns every row of a lookup table such as Languages
+func GetGenericMeta(db *sql.DB, table string) ([]ztdb.GenericDBMeta, error) {
+	results := make([]ztdb.GenericDBMeta, 0)
+	rows, err := db.Query(`
+		SELECT
+		ID, Name, Description
+		FROM ` + table + `
+		ORDER BY ID;
+	`)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := ztdb.GenericDBMeta{}
+		err := rows.Scan(&m.ID, &m.Name, &m.Description)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, m)
+	}
+	return results, rows.Err()
+}
+
 func OpenMemoryZTDB() (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", ":memory:")
 	if err != nil {
 		return nil, err
 	}
-
+	// every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+
+	// The page size and encoding are pinned so VACUUM INTO writes the same
+	// bytes for the same rows regardless of sqlite's compiled defaults.
+	// Foreign keys are enforced while building, lookup IDs of 0 are stored as
+	// NULL so they hold and queries read them back as 0. References within a
+	// table are checked when its bulk insert commits, parents may come later.
 	sqlStmt := `
+		PRAGMA page_size = 4096;
+		PRAGMA encoding = "UTF-8";
+		PRAGMA auto_vacuum = NONE;
+		PRAGMA foreign_keys = ON;
+
 		CREATE TABLE ZTDBInfo (
 			Version TEXT NOT NULL,
-			Description TEXT NOT NULL
+			Description TEXT NOT NULL,
+			Date TEXT NOT NULL
 		);
 
 		INSERT INTO ZTDBInfo
-		(Version, Description)
+		(Version, Description, Date)
 		VALUES
-		("1.0", "Initial Build");
+		("1.0", "Initial Build", "");
 
 		CREATE TABLE Systems (
 			ID INTEGER PRIMARY KEY,
@@ -150,7 +287,14 @@ func OpenMemoryZTDB() (*sql.DB, error) {
 		CREATE TABLE Regions (
 			ID INTEGER PRIMARY KEY,
 			Name TEXT NOT NULL,
-			Description TEXT NOT NULL
+			Description TEXT NOT NULL,
+			ISOCode TEXT NOT NULL DEFAULT '',
+			ParentRegionID INTEGER REFERENCES Regions (ID) DEFERRABLE INITIALLY DEFERRED
+		);
+
+		CREATE TABLE RegionAliases (
+			Alias TEXT NOT NULL PRIMARY KEY COLLATE NOCASE,
+			RegionID INTEGER NOT NULL REFERENCES Regions (ID)
 		);
 
 		CREATE TABLE Languages (
@@ -195,89 +339,285 @@ func OpenMemoryZTDB() (*sql.DB, error) {
 			Description TEXT NOT NULL
 		);
 
-		CREATE TABLE Titles (
+		CREATE TABLE Works (
 			ID INTEGER PRIMARY KEY,
 			Name TEXT NOT NULL,
 			Description TEXT NOT NULL
 		);
 
+		CREATE TABLE Titles (
+			ID INTEGER PRIMARY KEY,
+			Name TEXT NOT NULL,
+			Description TEXT NOT NULL,
+			WorkID INTEGER REFERENCES Works (ID)
+		);
+
 		CREATE TABLE TitleVariants (
 			ID INTEGER PRIMARY KEY,
-			TitleID INTEGER NOT NULL,
-			SystemID INTEGER NOT NULL,
+			TitleID INTEGER REFERENCES Titles (ID),
+			SystemID INTEGER NOT NULL REFERENCES Systems (ID),
 			Filename TEXT NOT NULL,
 			ReleaseYear INTEGER NOT NULL,
 			ReleaseMonth INTEGER NOT NULL,
 			Users INTEGER NOT NULL,
-			RegionID INTEGER NOT NULL,
-			PublisherID INTEGER NOT NULL,
-			DeveloperID INTEGER NOT NULL,
-			GenreID INTEGER NOT NULL,
-			FranchiseID INTEGER NOT NULL,
-			ExtensionID INTEGER NOT NULL,
-			UniqueTypeID INTEGER NOT NULL,
+			RegionID INTEGER REFERENCES Regions (ID),
+			PublisherID INTEGER REFERENCES Publishers (ID),
+			DeveloperID INTEGER REFERENCES Developers (ID),
+			GenreID INTEGER REFERENCES Genres (ID),
+			FranchiseID INTEGER REFERENCES Franchises (ID),
+			ExtensionID INTEGER REFERENCES FileExtensions (ID),
+			UniqueTypeID INTEGER REFERENCES UniqueTypes (ID),
 			Serial TEXT NOT NULL,
 			MD5 TEXT NOT NULL,
 			SHA1 TEXT NOT NULL,
 			CRC TEXT NOT NULL,
 			Size INTEGER NOT NULL,
 			Name TEXT NOT NULL,
-			Description TEXT NOT NULL
+			Description TEXT NOT NULL,
+			ParentVariantID INTEGER REFERENCES TitleVariants (ID) DEFERRABLE INITIALLY DEFERRED,
+			Version TEXT NOT NULL DEFAULT '',
+			Revision TEXT NOT NULL DEFAULT '',
+			VersionKey TEXT NOT NULL DEFAULT ''
+		);
+
+		-- inserting a variant looks up the clones waiting on it as a parent
+		CREATE INDEX TitleVariantsParent ON TitleVariants (ParentVariantID);
+
+		CREATE TABLE TitleVariantTracks (
+			ID INTEGER PRIMARY KEY,
+			TitleVariantID INTEGER NOT NULL REFERENCES TitleVariants (ID),
+			Number INTEGER NOT NULL,
+			Filename TEXT NOT NULL,
+			MD5 TEXT NOT NULL,
+			SHA1 TEXT NOT NULL,
+			CRC TEXT NOT NULL,
+			Size INTEGER NOT NULL
+		);
+
+		CREATE TABLE TitleVariantLanguages (
+			TitleVariantID INTEGER NOT NULL REFERENCES TitleVariants (ID),
+			LanguageID INTEGER NOT NULL REFERENCES Languages (ID),
+			Implied INTEGER NOT NULL,
+			PRIMARY KEY (TitleVariantID, LanguageID)
+		);
+
+		CREATE TABLE TitleVariantRegions (
+			TitleVariantID INTEGER NOT NULL REFERENCES TitleVariants (ID),
+			RegionID INTEGER NOT NULL REFERENCES Regions (ID),
+			PRIMARY KEY (TitleVariantID, RegionID)
 		);
 	`
 	_, err = db.Exec(sqlStmt)
 	return db, err
 }
 
+// Execer runs statements on a database or in a transaction
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func BulkInsertSystems(db *sql.DB, systems []ztdb.System) error {
-	db.Exec(`BEGIN`)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 	for _, system := range systems {
-		_, err := db.Exec(`
+		_, err = tx.Exec(`
 			INSERT INTO Systems
 			(ID, Name, ZaparooSystemID, Description)
 			VALUES
 			(?, ?, ?, ?);
 		`, system.ID, system.Name, system.ZaparooSystemID, system.Description)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 	}
-	db.Exec(`COMMIT`)
-	return nil
+	return tx.Commit()
+}
+
+func BulkInsertRegions(db *sql.DB, regions []ztdb.Region) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, region := range regions {
+		_, err = tx.Exec(`
+			INSERT INTO Regions
+			(ID, Name, Description, ISOCode, ParentRegionID)
+			VALUES
+			(?, ?, ?, ?, NULLIF(?, 0));
+		`, region.ID, region.Name, region.Description, region.ISOCode, region.ParentRegionID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, alias := range region.Aliases {
+			// aliases only differing in case are one alias
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO RegionAliases
+				(Alias, RegionID)
+				VALUES
+				(?, ?);
+			`, alias, region.ID)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func BulkInsertTitles(db *sql.DB, titles []ztdb.Title) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		_, err = tx.Exec(`
+			INSERT INTO Titles
+			(ID, Name, Description, WorkID)
+			VALUES
+			(?, ?, ?, NULLIF(?, 0));
+		`, title.ID, title.Name, title.Description, title.WorkID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func BulkInsertGenericMeta(db *sql.DB, table string, metas []ztdb.GenericDBMeta) error {
-	db.Exec(`BEGIN`)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
 	for _, meta := range metas {
-		_, err := db.Exec(`
+		_, err = tx.Exec(`
 			INSERT INTO `+table+`
 			(ID, Name, Description)
 			VALUES
 			(?, ?, ?);
 		`, meta.ID, meta.Name, meta.Description)
 		if err != nil {
+			tx.Rollback()
 			return err
 		}
 	}
-	db.Exec(`COMMIT`)
-	return nil
+	return tx.Commit()
 }
 
-func InsertTitleVariants(db *sql.DB, s ztdb.TitleVariant) error {
+func InsertTitleVariants(db Execer, s ztdb.TitleVariant) error {
 	_, err := db.Exec(`
 		INSERT INTO TitleVariants
 		(ID, TitleID, SystemID, Filename, ReleaseYear, ReleaseMonth, Users, RegionID, PublisherID, DeveloperID,
-		GenreID, FranchiseID, ExtensionID, UniqueTypeID, Serial, MD5, SHA1, CRC, Size, Name, Description)
+		GenreID, FranchiseID, ExtensionID, UniqueTypeID, Serial, MD5, SHA1, CRC, Size, Name, Description, ParentVariantID,
+		Version, Revision, VersionKey)
 		VALUES
 		(
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
-		?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		?, NULLIF(?, 0), ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0),
+		NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0),
+		?, ?, ?
 		);
 		`, s.ID, s.TitleID, s.SystemID, s.Filename, s.ReleaseYear, s.ReleaseMonth, s.Users, s.RegionID, s.PublisherID, s.DeveloperID,
-		s.GenreID, s.FranchiseID, s.ExtensionID, s.UniqueTypeID, s.Serial, s.MD5, s.SHA1, s.CRC, s.Size, s.Name, s.Description)
+		s.GenreID, s.FranchiseID, s.ExtensionID, s.UniqueTypeID, s.Serial, s.MD5, s.SHA1, s.CRC, s.Size, s.Name, s.Description, s.ParentVariantID,
+		s.Version, s.Revision, ztdb.VersionKey(s.Version, s.Revision))
 	return err
 }
 
+func InsertTitleVariantTrack(db Execer, t ztdb.TitleVariantTrack) error {
+	_, err := db.Exec(`
+		INSERT INTO TitleVariantTracks
+		(ID, TitleVariantID, Number, Filename, MD5, SHA1, CRC, Size)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?);
+		`, t.ID, t.TitleVariantID, t.Number, t.Filename, t.MD5, t.SHA1, t.CRC, t.Size)
+	return err
+}
+
+func BulkInsertTitleVariants(db *sql.DB, tvs []ztdb.TitleVariant) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, tv := range tvs {
+		err = InsertTitleVariants(tx, tv)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func BulkInsertTitleVariantTracks(db *sql.DB, tracks []ztdb.TitleVariantTrack) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		err = InsertTitleVariantTrack(tx, t)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func BulkInsertTitleVariantLanguages(db *sql.DB, tvls []ztdb.TitleVariantLanguage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, l := range tvls {
+		_, err = tx.Exec(`
+			INSERT INTO TitleVariantLanguages
+			(TitleVariantID, LanguageID, Implied)
+			VALUES
+			(?, ?, ?);
+		`, l.TitleVariantID, l.LanguageID, l.Implied)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func BulkInsertTitleVariantRegions(db *sql.DB, tvrs []ztdb.TitleVariantRegion) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range tvrs {
+		_, err = tx.Exec(`
+			INSERT INTO TitleVariantRegions
+			(TitleVariantID, RegionID)
+			VALUES
+			(?, ?);
+		`, r.TitleVariantID, r.RegionID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveZTDB writes an in memory database to path, replacing any existing file
+func SaveZTDB(db *sql.DB, path string) error {
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	_, err := db.Exec(`VACUUM INTO ?`, tmpPath)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
 func GetMetaNameID(db *sql.DB, table string, name any) (int, error) {
 	var id int
 	q, err := db.Prepare(`
@@ -295,33 +635,46 @@ func GetMetaNameID(db *sql.DB, table string, name any) (int, error) {
 }
 
 func GetTitleVariantsBySystemID(db *sql.DB, systemID int) ([]ztdb.TitleVariant, error) {
-	var results []ztdb.TitleVariant
-	stmt, err := db.Prepare(`
-		SELECT
-		ID, TitleID, SystemID, Filename,ReleaseYear, ReleaseMonth, Users, RegionID, PublisherID, DeveloperID,
-		GenreID, FranchiseID, ExtensionID, UniqueTypeID, Serial, MD5, SHA1, CRC, Size, Name, Description
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`
 		FROM TitleVariants
 		WHERE SystemID = ?
-	`)
-	rows, err := stmt.Query(systemID)
+		ORDER BY ID;
+	`, systemID)
 	if err != nil {
-		return results, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		s := ztdb.TitleVariant{}
-		err := rows.Scan(
-			&s.ID, &s.TitleID, &s.SystemID, &s.Filename, &s.ReleaseYear, &s.ReleaseMonth, &s.Users, &s.RegionID, &s.PublisherID, &s.DeveloperID,
-			&s.GenreID, &s.FranchiseID, &s.ExtensionID, &s.UniqueTypeID, &s.Serial, &s.MD5, &s.SHA1, &s.CRC, &s.Size, &s.Name, &s.Description,
-		)
-		if err != nil {
-			return results, err
-		}
-		results = append(results, s)
-	}
-	err = rows.Err()
-	if err != nil {
-		return results, err
+		return nil, err
 	}
-	return results, nil
+	return scanTitleVariants(rows)
+}
+
+// CreateZTDBIndexes adds an index for every match key, it's run once the
+// rows are inserted so each index is built in a single pass. Match key indexes
+// carry the RecordFilter columns so filtered lookups only read the rows they
+// return, the rowid every index ends with keeps equal keys in ID order.
+// ANALYZE lets the planner pick the most selective index when several apply.
+func CreateZTDBIndexes(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE INDEX TitleVariantsSHA1 ON TitleVariants (SHA1, SystemID, TitleID, Size);
+		CREATE INDEX TitleVariantsMD5 ON TitleVariants (MD5, SystemID, TitleID, Size);
+		CREATE INDEX TitleVariantsCRC ON TitleVariants (CRC, SystemID, TitleID, Size);
+		CREATE INDEX TitleVariantsSerial ON TitleVariants (Serial, SystemID, TitleID, Size);
+		CREATE INDEX TitleVariantsFilename ON TitleVariants (Filename, SystemID, TitleID, Size);
+		CREATE INDEX TitleVariantsSize ON TitleVariants (Size);
+		CREATE INDEX TitleVariantsSystemFilename ON TitleVariants (SystemID, Filename);
+		CREATE INDEX TitleVariantsSystemTitle ON TitleVariants (SystemID, TitleID);
+		CREATE INDEX TitleVariantsTitle ON TitleVariants (TitleID, SystemID);
+		CREATE INDEX TitleVariantsTitleVersion ON TitleVariants (TitleID, VersionKey);
+		CREATE INDEX TitlesWork ON Titles (WorkID);
+
+		CREATE INDEX TitleVariantTracksTitleVariant ON TitleVariantTracks (TitleVariantID, Number);
+		CREATE INDEX TitleVariantTracksSHA1 ON TitleVariantTracks (SHA1, TitleVariantID);
+		CREATE INDEX TitleVariantTracksNumberSize ON TitleVariantTracks (Number, Size, TitleVariantID);
+
+		CREATE INDEX TitleVariantLanguagesLanguage ON TitleVariantLanguages (LanguageID, TitleVariantID);
+		CREATE INDEX TitleVariantRegionsRegion ON TitleVariantRegions (RegionID, TitleVariantID);
+		CREATE INDEX RegionAliasesRegion ON RegionAliases (RegionID);
+
+		ANALYZE;
+	`)
+	return err
 }
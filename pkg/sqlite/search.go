@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-titles-database/pkg/ztdb"
+)
+
+/*
+Full text search over titles, variant names, filenames and alternate names
+using an FTS5 table keyed by TitleVariant ID. Alternate names are the
+variant's and title's descriptions, the title's work and the other titles of
+that work, so a game is found by its name on any system. Languages are stored
+as the space padded language IDs of the variant's TitleVariantLanguages.
+Regions are stored the same way with every region the variant is playable in,
+its regions and the regions inside them, see ztdb.PlayableRegionIDs, so a
+World release is found by any region filter and a German one only by Germany.
+*/
+
+const TableTitleVariantSearch string = "TitleVariantsSearch"
+
+var ErrNoFTS5 = errors.New("sqlite built without FTS5, rebuild with -tags sqlite_fts5")
+
+var searchWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+type SearchOptions struct {
+	// 0 doesn't filter
+	SystemID   int
+	RegionID   int
+	LanguageID int
+	// defaults to 50
+	Limit int
+}
+
+type SearchResult struct {
+	Title   string            `json:"title"`
+	Rank    float64           `json:"rank"`
+	Variant ztdb.TitleVariant `json:"variant"`
+}
+
+// CreateSearchIndex fills the search table from TitleVariants, titles come
+// from Titles when known and from the variant name otherwise.
+func CreateSearchIndex(db *sql.DB) error {
+	if !FTS5Enabled {
+		return ErrNoFTS5
+	}
+
+	titles := make(map[int]string)
+	titleAltNames := make(map[int][]string)
+	rows, err := db.Query(`
+		SELECT Titles.ID, Titles.Name, Titles.Description, IFNULL(Works.Name, '')
+		FROM Titles
+		LEFT JOIN Works ON Works.ID = Titles.WorkID
+		ORDER BY Titles.ID;
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name, description, work string
+		if err := rows.Scan(&id, &name, &description, &work); err != nil {
+			rows.Close()
+			return err
+		}
+		titles[id] = name
+		titleAltNames[id] = []string{description, work}
+	}
+	rows.Close()
+
+	// the other titles of a work are the game's names on other systems
+	rows, err = db.Query(`
+		SELECT Titles.ID, Others.Name
+		FROM Titles
+		JOIN Titles AS Others ON Others.WorkID = Titles.WorkID AND Others.ID != Titles.ID
+		ORDER BY Titles.ID, Others.ID;
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		titleAltNames[id] = append(titleAltNames[id], name)
+	}
+	rows.Close()
+
+	languages := make(map[int]string)
+	rows, err = db.Query(`
+		SELECT TitleVariantID, LanguageID
+		FROM TitleVariantLanguages
+		ORDER BY TitleVariantID, LanguageID;
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var tvID, languageID int
+		if err := rows.Scan(&tvID, &languageID); err != nil {
+			rows.Close()
+			return err
+		}
+		languages[tvID] += fmt.Sprintf("%v ", languageID)
+	}
+	rows.Close()
+
+	playable := make(map[int][]int)
+	regionList, err := GetRegions(db)
+	if err != nil {
+		return err
+	}
+	// a release is playable in its region and every region inside it
+	for _, r := range regionList {
+		for _, id := range ztdb.PlayableRegionIDs(regionList, r.ID) {
+			playable[id] = append(playable[id], r.ID)
+		}
+	}
+	regions := make(map[int][]int)
+	rows, err = db.Query(`
+		SELECT TitleVariantID, RegionID
+		FROM TitleVariantRegions
+		ORDER BY TitleVariantID, RegionID;
+	`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var tvID, regionID int
+		if err := rows.Scan(&tvID, &regionID); err != nil {
+			rows.Close()
+			return err
+		}
+		regions[tvID] = append(regions[tvID], regionID)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT` + titleVariantColumns + `
+		FROM TitleVariants
+		ORDER BY ID;
+	`)
+	if err != nil {
+		return err
+	}
+	tvs, err := scanTitleVariants(rows)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE VIRTUAL TABLE TitleVariantsSearch USING fts5 (
+			Title,
+			Name,
+			Filename,
+			AltNames,
+			SystemID UNINDEXED,
+			Regions UNINDEXED,
+			Languages UNINDEXED,
+			tokenize = 'unicode61 remove_diacritics 2',
+			prefix = '2 3'
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, tv := range tvs {
+		frag := ztdb.GetFileFragments(tv.Filename)
+		name := tv.Name
+		if name == "" {
+			name = frag.FileNameNoExt
+		}
+		title, ok := titles[tv.TitleID]
+		if !ok || title == "" {
+			title = ztdb.GetTitleFromName(name)
+		}
+		altNames := joinAltNames(title, append([]string{tv.Description}, titleAltNames[tv.TitleID]...))
+		langIDs := " " + languages[tv.ID]
+		tvRegions, ok := regions[tv.ID]
+		if !ok && tv.RegionID != 0 {
+			tvRegions = []int{tv.RegionID}
+		}
+		seen := make(map[int]bool)
+		regionIDs := " "
+		for _, regionID := range tvRegions {
+			for _, id := range playable[regionID] {
+				if !seen[id] {
+					seen[id] = true
+					regionIDs += fmt.Sprintf("%v ", id)
+				}
+			}
+		}
+		_, err = tx.Exec(`
+			INSERT INTO TitleVariantsSearch
+			(rowid, Title, Name, Filename, AltNames, SystemID, Regions, Languages)
+			VALUES
+			(?, ?, ?, ?, ?, ?, ?, ?);
+		`, tv.ID, title, name, frag.FileNameNoExt, altNames, tv.SystemID, regionIDs, langIDs)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO TitleVariantsSearch (TitleVariantsSearch) VALUES ('optimize');`)
+	return err
+}
+
+// joinAltNames joins the distinct names other than the title, one per line
+func joinAltNames(title string, names []string) string {
+	seen := map[string]bool{"": true, strings.ToLower(title): true}
+	alt := make([]string, 0, len(names))
+	for _, name := range names {
+		key := strings.ToLower(name)
+		if !seen[key] {
+			seen[key] = true
+			alt = append(alt, name)
+		}
+	}
+	return strings.Join(alt, "\n")
+}
+
+// SearchQuery turns free text into an FTS5 query where every word must match
+// as a prefix, so "mario ka" finds "Mario Kart". It isn't fuzzy, misspelled
+// words don't match.
+func SearchQuery(text string) string {
+	words := searchWord.FindAllString(strings.ToLower(text), -1)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchTitleVariants ranks matches with BM25, title matches weigh the most
+// and filename matches the least.
+func SearchTitleVariants(db *sql.DB, text string, opts SearchOptions) ([]SearchResult, error) {
+	if !FTS5Enabled {
+		return nil, ErrNoFTS5
+	}
+	query := SearchQuery(text)
+	if query == "" {
+		return []SearchResult{}, nil
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 50
+	}
+
+	rows, err := db.Query(`
+		SELECT`+titleVariantColumns+`, Results.Title, Results.Rank
+		FROM (
+			SELECT
+			rowid AS SearchID, Title, bm25(TitleVariantsSearch, 10.0, 5.0, 1.0, 2.0) AS Rank
+			FROM TitleVariantsSearch
+			WHERE TitleVariantsSearch MATCH ?
+			AND (? = 0 OR SystemID = ?)
+			AND (? = 0 OR instr(Regions, ' ' || ? || ' ') > 0)
+			AND (? = 0 OR instr(Languages, ' ' || ? || ' ') > 0)
+			ORDER BY Rank, SearchID
+			LIMIT ?
+		) AS Results
+		JOIN TitleVariants ON TitleVariants.ID = Results.SearchID
+		ORDER BY Results.Rank, TitleVariants.ID;
+	`, query, opts.SystemID, opts.SystemID, opts.RegionID, opts.RegionID, opts.LanguageID, opts.LanguageID, opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		r := SearchResult{}
+		s := &r.Variant
+		err := rows.Scan(
+			&s.ID, &s.TitleID, &s.SystemID, &s.Filename, &s.ReleaseYear, &s.ReleaseMonth, &s.Users, &s.RegionID, &s.PublisherID, &s.DeveloperID,
+			&s.GenreID, &s.FranchiseID, &s.ExtensionID, &s.UniqueTypeID, &s.Serial, &s.MD5, &s.SHA1, &s.CRC, &s.Size, &s.Name, &s.Description,
+			&s.ParentVariantID, &s.Version, &s.Revision,
+			&r.Title, &r.Rank,
+		)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
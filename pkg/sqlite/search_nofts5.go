@@ -0,0 +1,6 @@
+//go:build !(sqlite_fts5 || fts5)
+
+package sqlite
+
+// FTS5Enabled is set when go-sqlite3 is built with the sqlite_fts5 tag
+const FTS5Enabled = false
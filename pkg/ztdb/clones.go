@@ -0,0 +1,160 @@
+package ztdb
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+Parent/clone inference for variants no DAT gave a parent. Variants of the same
+title on the same system are clones of one parent, picked the way No-Intro
+picks them: a good dump over betas, demos, hacks and bad dumps, then the
+widest region, then the fewest tags, then a file named after its name over a
+renamed one such as a mini console dump. A variant that already has clones from a
+DAT stays a parent and is picked first.
+*/
+
+var (
+	// lower is wider, TOSEC codes rank with their No-Intro names
+	cloneRegionTag = map[string]int{"world": 0, "usa": 1, "us": 1, "europe": 2, "eu": 2, "japan": 3, "jp": 3}
+	cloneTagWord   = regexp.MustCompile(`[a-z]+`)
+)
+
+// flaggedStatus are the statuses of releases that aren't the finished game
+var flaggedStatus = map[string]bool{
+	"Alpha": true, "Beta": true, "Proto": true, "Demo": true, "Sample": true,
+	"Preview": true, "Pre-Release": true, "Kiosk": true, "Debug": true,
+	"Pirate": true, "Bootleg": true,
+}
+
+type cloneRank struct {
+	flagged, region, tags, renamed int
+}
+
+func (r cloneRank) less(o cloneRank) bool {
+	if r.flagged != o.flagged {
+		return r.flagged < o.flagged
+	}
+	if r.region != o.region {
+		return r.region < o.region
+	}
+	if r.tags != o.tags {
+		return r.tags < o.tags
+	}
+	return r.renamed < o.renamed
+}
+
+// rankParent orders the parent candidates of a title, lower is better
+func rankParent(tv TitleVariant) cloneRank {
+	base := GetFileFragments(tv.Filename).FileNameNoExt
+	name, renamed := tv.Name, 0
+	if name == "" {
+		name = base
+	} else if name != base {
+		renamed = 1
+	}
+	tags := ""
+	if i := strings.IndexAny(name, "(["); i >= 0 {
+		tags = name[i:]
+	}
+
+	flagged := 0
+	if ParseFileTags(name).DumpRank() == DumpFlagged {
+		flagged = 1
+	}
+	region := len(cloneRegionTag)
+	for _, word := range cloneTagWord.FindAllString(strings.ToLower(tags), -1) {
+		if i, ok := cloneRegionTag[word]; ok && i < region {
+			region = i
+		}
+	}
+	return cloneRank{flagged, region, strings.Count(tags, "(") + strings.Count(tags, "["), renamed}
+}
+
+// Dump ranks, lower is better
+const (
+	DumpVerified = iota
+	DumpUnflagged
+	DumpAlternate
+	DumpFlagged
+)
+
+// DumpRank ranks the dump flags and status of a name. A verified [!] dump
+// comes first, then an unflagged one, then an alternate, then betas, demos,
+// hacks, bad dumps and anything else that isn't the released game.
+// Unlicensed and aftermarket releases aren't flagged.
+func (t FileTags) DumpRank() int {
+	for _, s := range t.Status {
+		if flaggedStatus[s] {
+			return DumpFlagged
+		}
+	}
+	rank := DumpUnflagged
+	for _, f := range t.DumpFlags {
+		switch f.Flag {
+		case "!":
+			rank = DumpVerified
+		case "a":
+			if rank == DumpUnflagged {
+				rank = DumpAlternate
+			}
+		default:
+			return DumpFlagged
+		}
+	}
+	return rank
+}
+
+// InferParentVariants fills in ParentVariantID for every variant of a title
+// that has none, grouped by system. Variants without a title are left alone.
+// Returns how many parents were inferred.
+func InferParentVariants(tvs []TitleVariant) int {
+	hasClones := make(map[int]bool)
+	for _, tv := range tvs {
+		if tv.ParentVariantID != 0 {
+			hasClones[tv.ParentVariantID] = true
+		}
+	}
+
+	type groupKey struct{ systemID, titleID int }
+	groups := make(map[groupKey][]int)
+	for i, tv := range tvs {
+		if tv.TitleID == 0 || tv.ParentVariantID != 0 {
+			continue
+		}
+		k := groupKey{tv.SystemID, tv.TitleID}
+		groups[k] = append(groups[k], i)
+	}
+
+	inferred := 0
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		ranks := make(map[int]cloneRank, len(members))
+		for _, i := range members {
+			ranks[i] = rankParent(tvs[i])
+		}
+		sort.Slice(members, func(a, b int) bool {
+			x, y := tvs[members[a]], tvs[members[b]]
+			if hasClones[x.ID] != hasClones[y.ID] {
+				return hasClones[x.ID]
+			}
+			if ranks[members[a]] != ranks[members[b]] {
+				return ranks[members[a]].less(ranks[members[b]])
+			}
+			return x.ID < y.ID
+		})
+		parent := tvs[members[0]].ID
+		for _, i := range members[1:] {
+			// other DAT parents of the same title keep their own clones
+			if hasClones[tvs[i].ID] {
+				continue
+			}
+			tvs[i].ParentVariantID = parent
+			inferred++
+		}
+	}
+	return inferred
+}
@@ -0,0 +1,28 @@
+package ztdb
+
+import "testing"
+
+func TestDumpRank(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"Super Mario Land (World) (Rev 1)", DumpUnflagged},
+		{"Tetris (World) [!]", DumpVerified},
+		{"Tetris (World) [a][!]", DumpVerified},
+		{"Tetris (World) [a]", DumpAlternate},
+		{"1001 BC (ERE Informatique) (France) (Alt 1)", DumpAlternate},
+		{"Zuigao Jimi (Top Secret) (Taiwan) (Unl)", DumpUnflagged},
+		{"1942 (Small) (World) (Aftermarket) (Unl)", DumpUnflagged},
+		{"Tetris (World) [b2]", DumpFlagged},
+		{"Tetris (World) [a][h Someone]", DumpFlagged},
+		{"Abbey Of Crime, The (Opera Soft) (Hack)", DumpFlagged},
+		{"Legend of Zelda, The (USA) (Beta)", DumpFlagged},
+		{"Gun.Smoke (World, 851115) (bootleg)", DumpFlagged},
+	}
+	for _, tt := range tests {
+		if got := ParseFileTags(tt.name).DumpRank(); got != tt.want {
+			t.Errorf("DumpRank(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ztdb
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,12 @@ import (
 	"github.com/ZaparooProject/zaparoo-titles-database/pkg/settings"
 )
 
+type ZTDBInfo struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Date        string `json:"date"`
+}
+
 type System struct {
 	ID              int    `json:"id"`
 	Name            string `json:"name"`
@@ -19,9 +26,12 @@ type System struct {
 }
 
 type Region struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	ID             int      `json:"id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	ISOCode        string   `json:"iso_code,omitempty"`
+	ParentRegionID int      `json:"parent_region_id,omitempty"`
+	Aliases        []string `json:"aliases,omitempty"`
 }
 
 type Language struct {
@@ -66,10 +76,18 @@ type UniqueType struct {
 	Description string `json:"description"`
 }
 
+// Work is the same game across systems, it groups Titles
+type Work struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
 type Title struct {
 	ID          int    `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	WorkID      int    `json:"work_id"`
 }
 
 type TitleVariant struct {
@@ -94,12 +112,81 @@ type TitleVariant struct {
 	Size         int    `json:"size"`
 	Name         string `json:"name"`
 	Description  string `json:"description"`
+	// NoDescription is set when the source had no description, an empty
+	// Description is otherwise the same as the name, see CompactNames
+	NoDescription bool `json:"no_description,omitempty"`
+	// ParentVariantID is the variant this is a clone of, 0 for parents. Only
+	// DAT cloneof and hand edits are stored, the build infers the rest.
+	ParentVariantID int `json:"parent_variant_id,omitempty"`
+	// Version and Revision are parsed from the name by the build unless one
+	// is set, see FillVersions
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// TitleVariantLanguage is a language a TitleVariant is in, from the language
+// tags of its name or implied by its region when the name has none
+type TitleVariantLanguage struct {
+	TitleVariantID int  `json:"title_variant_id"`
+	LanguageID     int  `json:"language_id"`
+	Implied        bool `json:"implied,omitempty"`
+}
+
+// TitleVariantRegion is a region a TitleVariant was released in, from the
+// region tags of its name and its RegionID
+type TitleVariantRegion struct {
+	TitleVariantID int `json:"title_variant_id"`
+	RegionID       int `json:"region_id"`
+}
+
+// TitleVariantTrack is one track file of a multi track disc, the TitleVariant
+// it belongs to represents the whole disc.
+type TitleVariantTrack struct {
+	ID             int    `json:"id"`
+	TitleVariantID int    `json:"title_variant_id"`
+	Number         int    `json:"number"`
+	Filename       string `json:"filename"`
+	MD5            string `json:"md5"`
+	SHA1           string `json:"sha1"`
+	CRC            string `json:"crc"`
+	Size           int    `json:"size"`
+}
+
+// TitleOverride pins a title grouping that GetTitleFromVariant gets wrong,
+// either a single TitleVariant or every variant whose derived title is Name.
+type TitleOverride struct {
+	TitleVariantID int    `json:"title_variant_id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	TitleID        int    `json:"title_id"`
+}
+
+// WorkOverride pins a title to a work when GetWorkKey groups it wrong
+type WorkOverride struct {
+	TitleID int `json:"title_id"`
+	WorkID  int `json:"work_id"`
+}
+
+// TitleVariantRecord is a TitleVariant joined with the names of everything it
+// references, names are empty when unset.
+type TitleVariantRecord struct {
+	Variant   TitleVariant `json:"variant"`
+	Title     string       `json:"title"`
+	WorkID    int          `json:"work_id"`
+	Work      string       `json:"work"`
+	System    System       `json:"system"`
+	Region    string       `json:"region"`
+	Regions   []string     `json:"regions"`
+	Languages []string     `json:"languages"`
+	Publisher string       `json:"publisher"`
+	Developer string       `json:"developer"`
+	Genre     string       `json:"genre"`
+	Franchise string       `json:"franchise"`
 }
 
 type GenericDBMeta struct {
-	ID          int
-	Name        string
-	Description string
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 func MarshalMeta(meta any) (string, error) {
@@ -114,14 +201,28 @@ func UnmarshalMeta(meta *any, jsonStr string) error {
 	return json.Unmarshal([]byte(jsonStr), meta)
 }
 
-func LoadNDJSON[T GenericDBMeta | TitleVariant | System](metaType string, metas []T) ([]T, error) {
+type ndjsonRow interface {
+	GenericDBMeta | System | Region | Title | TitleVariant | TitleVariantTrack | TitleVariantLanguage | TitleVariantRegion | TitleOverride | WorkOverride
+}
+
+func LoadNDJSON[T ndjsonRow](metaType string, metas []T) ([]T, error) {
 	ndjsonPath := filepath.Join(settings.DBJsonDir, fmt.Sprintf("_%v.ndjson", metaType))
+	return loadNDJSONPath(ndjsonPath, metas)
+}
+
+func LoadSystemNDJSON(systemName string) ([]TitleVariant, error) {
+	ndjsonPath := filepath.Join(settings.DBJsonDir, fmt.Sprintf("%v.ndjson", systemName))
+	return loadNDJSONPath(ndjsonPath, make([]TitleVariant, 0))
+}
+
+func loadNDJSONPath[T ndjsonRow](ndjsonPath string, metas []T) ([]T, error) {
 	fmt.Printf("Opening %s\n", ndjsonPath)
 	ndjsonFile, err := os.Open(ndjsonPath)
 	if err != nil {
 		fmt.Printf("Error openingT %s\n", ndjsonPath)
 		return metas, err
 	}
+	defer ndjsonFile.Close()
 	fmt.Printf("Trying ReadAll from Local %s\n", ndjsonPath)
 	jsonStream, err := io.ReadAll(ndjsonFile)
 	if err != nil && err != io.EOF {
@@ -142,3 +243,31 @@ func LoadNDJSON[T GenericDBMeta | TitleVariant | System](metaType string, metas
 	}
 	return metas, nil
 }
+
+func SaveNDJSON[T ndjsonRow](metaType string, metas []T) error {
+	ndjsonPath := filepath.Join(settings.DBJsonDir, fmt.Sprintf("_%v.ndjson", metaType))
+	return saveNDJSONPath(ndjsonPath, metas)
+}
+
+func SaveSystemNDJSON(systemName string, tvs []TitleVariant) error {
+	ndjsonPath := filepath.Join(settings.DBJsonDir, fmt.Sprintf("%v.ndjson", systemName))
+	return saveNDJSONPath(ndjsonPath, tvs)
+}
+
+func saveNDJSONPath[T ndjsonRow](ndjsonPath string, metas []T) error {
+	outfile, err := os.Create(ndjsonPath)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	w := bufio.NewWriter(outfile)
+	for _, meta := range metas {
+		b, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+		w.WriteString("\n")
+	}
+	return w.Flush()
+}
@@ -0,0 +1,34 @@
+package ztdb
+
+import "strings"
+
+// Names returns the lowercase name, ISO 3166 code and aliases a region is
+// known by, the name first
+func (r Region) Names() []string {
+	names := []string{strings.ToLower(r.Name)}
+	if r.ISOCode != "" {
+		names = append(names, strings.ToLower(r.ISOCode))
+	}
+	for _, alias := range r.Aliases {
+		names = append(names, strings.ToLower(alias))
+	}
+	return names
+}
+
+// PlayableRegionIDs returns the IDs of the regions whose releases are
+// playable in region id: the region itself and the regions containing it,
+// Germany, Europe and World for Germany. Releases of regions inside it aren't,
+// a German release isn't playable everywhere in Europe. Parent loops are cut.
+func PlayableRegionIDs(regions []Region, id int) []int {
+	parents := make(map[int]int, len(regions))
+	for _, r := range regions {
+		parents[r.ID] = r.ParentRegionID
+	}
+	ids := []int{id}
+	seen := map[int]bool{id: true}
+	for p := parents[id]; p != 0 && !seen[p]; p = parents[p] {
+		seen[p] = true
+		ids = append(ids, p)
+	}
+	return ids
+}
@@ -0,0 +1,33 @@
+package ztdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlayableRegionIDs(t *testing.T) {
+	regions := []Region{
+		{ID: 1, Name: "World"},
+		{ID: 2, Name: "Europe", ParentRegionID: 1},
+		{ID: 3, Name: "Germany", ISOCode: "DE", ParentRegionID: 2},
+		{ID: 4, Name: "Japan", ISOCode: "JP", ParentRegionID: 1},
+		// a parent loop
+		{ID: 10, Name: "North", ParentRegionID: 11},
+		{ID: 11, Name: "South", ParentRegionID: 10},
+	}
+	tests := []struct {
+		name string
+		id   int
+		ids  []int
+	}{
+		{"Germany", 3, []int{3, 2, 1}},
+		{"Europe", 2, []int{2, 1}},
+		{"World", 1, []int{1}},
+		{"parent loop", 10, []int{10, 11}},
+	}
+	for _, tt := range tests {
+		if ids := PlayableRegionIDs(regions, tt.id); !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%v: PlayableRegionIDs = %v, want %v", tt.name, ids, tt.ids)
+		}
+	}
+}
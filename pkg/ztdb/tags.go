@@ -0,0 +1,415 @@
+package ztdb
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/*
+Parses the tags No-Intro, Redump and TOSEC put after a title, e.g.
+
+	Legend of Zelda, The (USA, Europe) (En,Fr,De) (Rev 1) (Beta)
+	Final Fantasy VII (USA) (Disc 2)
+	Black Land v1.1 (1991-05)(Bollaware)(de)(Disk 1 of 2)[cr XOR][t +2]
+
+Regions are kept as written, No-Intro names and TOSEC country codes are not
+mapped to each other here, the Regions aliases do that. The first tag no rule
+claims before any region or language is the publisher, TOSEC's second tag and
+the libretro "Title (Publisher)" style. Tags nothing claims are kept in
+Leftovers as written, with their brackets.
+*/
+
+type FileTags struct {
+	Regions []string `json:"regions,omitempty"`
+	// Languages are lowercase codes, "en"
+	Languages []string `json:"languages,omitempty"`
+	// LanguageCount is 3 of "(M3)", the names don't say which languages
+	LanguageCount int `json:"language_count,omitempty"`
+	// Version is "1.1" of "(v1.1)", "(Version 1.1)", "[v1.1]" or a TOSEC
+	// "Title v1.1"
+	Version string `json:"version,omitempty"`
+	// Revision is "A" of "(Rev A)" or "Title Rev A"
+	Revision string `json:"revision,omitempty"`
+	// Disc is 0 when unknown, TOSEC disk letters count from A as 1
+	Disc      int        `json:"disc,omitempty"`
+	DiscTotal int        `json:"disc_total,omitempty"`
+	DumpFlags []DumpFlag `json:"dump_flags,omitempty"`
+	// Status is Alpha, Beta, Proto, Demo, Sample, Preview, Pre-Release, Promo,
+	// Kiosk, Debug, Unl, Aftermarket, Pirate or Bootleg
+	Status []string `json:"status,omitempty"`
+	// Date is as written, "1991", "19xx" or "1990-10-25"
+	Date      string   `json:"date,omitempty"`
+	Publisher string   `json:"publisher,omitempty"`
+	Leftovers []string `json:"leftovers,omitempty"`
+}
+
+// DumpFlag is a TOSEC "[b2]" or "[h Someone]" tag, the flag is "b" and "h".
+// No-Intro "(Alt 1)" is the flag "a" and "(Hack by Someone)" the flag "h". "!"
+// is a verified good dump.
+type DumpFlag struct {
+	Flag   string `json:"flag"`
+	Number int    `json:"number,omitempty"`
+	Info   string `json:"info,omitempty"`
+}
+
+var (
+	tagDate        = regexp.MustCompile(`^(?i)(1[89]|20)[\dx]{2}(-[\dx]{2}(-[\dx]{2})?)?$`)
+	tagVersion     = regexp.MustCompile(`^(?:v|Version )(\d[\w.\-]*)$`)
+	tagTitleVer    = regexp.MustCompile(` v(\d[\w.]*)$`)
+	tagTitleRev    = regexp.MustCompile(` Rev ([\w.]+)$`)
+	tagBracketVer  = regexp.MustCompile(`^v(\d[\w.]*)$`)
+	tagRevision    = regexp.MustCompile(`^Rev ([\w.]+)$`)
+	tagDisc        = regexp.MustCompile(`^Dis[ck] (\d+|[A-Z])(?: of (\d+))?$`)
+	tagAlt         = regexp.MustCompile(`^Alt(?: (\d+))?$`)
+	tagHack        = regexp.MustCompile(`^Hack(?: by (.+))?$`)
+	tagStatus      = regexp.MustCompile(`^(?i)(alpha|beta|proto|prototype|demo|sample|preview|pre-release|promo|kiosk|debug|unl|unlicensed|aftermarket|pirate|bootleg)(?: [\w.\-]+)?$`)
+	tagDumpFlag    = regexp.MustCompile(`^(!|a|b|cr|f|h|m|o|p|t|tr|u|v)(\d*)(?: (.+))?$`)
+	tagTOSECRegion = regexp.MustCompile(`^[A-Z]{2}(-[A-Z]{2})*$`)
+	tagTOSECLang   = regexp.MustCompile(`^[a-z]{2}(-[a-z]{2})*$`)
+	tagNoIntroLang = regexp.MustCompile(`^[A-Z][a-z](-[A-Z][a-z]+)?(,[A-Z][a-z](-[A-Z][a-z]+)?)*$`)
+	tagLangCount   = regexp.MustCompile(`^M(\d+)$`)
+	// TOSEC copyright and video tags, Neo Geo serials, MAME sets, editions,
+	// versions, cartridge colours and sizes and GoodTools letter codes
+	// are never the publisher
+	tagNotPublisher = regexp.MustCompile(`^((PD|SW|FW|GW|LW|CW)(-R)?|PAL(-60)?|NTSC|SECAM|NG[MH]-\d+|Neo-Geo|set \d+|.* Edition|.* the Best|.*\bVersion\b.*|Homebrew|Export|Small|Large|Extended|SDHC|(Light |Dark )?(Black|White|Gr[ae]y|Red|Blue|Green|Yellow|Orange|Pink|Purple)|[A-Z])$`)
+)
+
+var tagStatusNames = map[string]string{
+	"alpha": "Alpha", "beta": "Beta", "proto": "Proto", "prototype": "Proto",
+	"demo": "Demo", "sample": "Sample", "preview": "Preview",
+	"pre-release": "Pre-Release", "promo": "Promo", "kiosk": "Kiosk",
+	"debug": "Debug", "unl": "Unl", "unlicensed": "Unl",
+	"aftermarket": "Aftermarket", "pirate": "Pirate", "bootleg": "Bootleg",
+}
+
+// TagRegions are the No-Intro and Redump region names
+var TagRegions = map[string]bool{
+	"World": true, "USA": true, "Europe": true, "Japan": true, "Asia": true,
+	"Australia": true, "Brazil": true, "Canada": true, "China": true,
+	"France": true, "Germany": true, "Hong Kong": true, "Italy": true,
+	"Korea": true, "Netherlands": true, "Spain": true, "Sweden": true,
+	"Taiwan": true, "UK": true, "United Kingdom": true, "Russia": true,
+	"Scandinavia": true, "Greece": true, "Finland": true, "Norway": true,
+	"Denmark": true, "Portugal": true, "Poland": true, "Mexico": true,
+	"Latin America": true, "Argentina": true, "Belgium": true, "Austria": true,
+	"Switzerland": true, "India": true, "Ireland": true, "New Zealand": true,
+	"South Africa": true, "Turkey": true, "Israel": true, "Croatia": true,
+	"Czech": true, "Hungary": true, "Slovakia": true, "Unknown": true,
+}
+
+// TagCountryCodes are the TOSEC ISO 3166 country codes plus EU
+var TagCountryCodes = map[string]bool{
+	"AE": true, "AL": true, "AS": true, "AT": true, "AU": true, "BA": true,
+	"BE": true, "BG": true, "BR": true, "CA": true, "CH": true, "CL": true,
+	"CN": true, "CS": true, "CY": true, "CZ": true, "DE": true, "DK": true,
+	"EE": true, "EG": true, "ES": true, "EU": true, "FI": true, "FR": true,
+	"GB": true, "GR": true, "HK": true, "HR": true, "HU": true, "ID": true,
+	"IE": true, "IL": true, "IN": true, "IR": true, "IS": true, "IT": true,
+	"JO": true, "JP": true, "KR": true, "LT": true, "LU": true, "LV": true,
+	"MN": true, "MX": true, "MY": true, "NL": true, "NO": true, "NP": true,
+	"NZ": true, "OM": true, "PE": true, "PH": true, "PL": true, "PT": true,
+	"QA": true, "RO": true, "RU": true, "SE": true, "SG": true, "SI": true,
+	"SK": true, "TH": true, "TR": true, "TW": true, "US": true, "VN": true,
+	"YU": true, "ZA": true,
+}
+
+// TagLanguages are the lowercase language codes both groups use
+var TagLanguages = map[string]bool{
+	"ar": true, "bg": true, "bs": true, "ca": true, "cs": true, "cy": true,
+	"da": true, "de": true, "el": true, "en": true, "eo": true, "es": true,
+	"et": true, "eu": true, "fa": true, "fi": true, "fr": true, "ga": true,
+	"gd": true, "gu": true, "he": true, "hi": true, "hr": true, "hu": true,
+	"id": true, "is": true, "it": true, "ja": true, "ko": true, "lt": true,
+	"lv": true, "ms": true, "nl": true, "no": true, "pl": true, "pt": true,
+	"ro": true, "ru": true, "sk": true, "sl": true, "sq": true, "sr": true,
+	"sv": true, "th": true, "tr": true, "uk": true, "ur": true, "vi": true,
+	"yi": true, "zh": true, "zh-hans": true, "zh-hant": true,
+}
+
+// regionLanguages is the language a region implies when a name has no
+// language tag, keyed by lowercase region name or TOSEC code. No-Intro leaves
+// out (En) for World and Europe. Regions with no single language are missing.
+var regionLanguages = map[string]string{
+	"world": "en", "usa": "en", "us": "en", "europe": "en", "eu": "en",
+	"uk": "en", "united kingdom": "en", "gb": "en", "australia": "en",
+	"au": "en", "new zealand": "en", "nz": "en", "ireland": "en", "ie": "en",
+	"canada": "en", "ca": "en", "japan": "ja", "jp": "ja", "germany": "de",
+	"de": "de", "austria": "de", "at": "de", "france": "fr", "fr": "fr",
+	"spain": "es", "es": "es", "mexico": "es", "mx": "es", "argentina": "es",
+	"latin america": "es", "italy": "it", "it": "it", "netherlands": "nl",
+	"nl": "nl", "sweden": "sv", "se": "sv", "brazil": "pt", "br": "pt",
+	"portugal": "pt", "pt": "pt", "korea": "ko", "kr": "ko", "china": "zh",
+	"cn": "zh", "taiwan": "zh", "tw": "zh", "hong kong": "zh", "hk": "zh",
+	"russia": "ru", "ru": "ru", "poland": "pl", "pl": "pl", "denmark": "da",
+	"dk": "da", "norway": "no", "no": "no", "finland": "fi", "fi": "fi",
+	"greece": "el", "gr": "el", "turkey": "tr", "tr": "tr", "hungary": "hu",
+	"hu": "hu", "czech": "cs", "czech republic": "cs", "cz": "cs",
+	"croatia": "hr", "hr": "hr", "slovakia": "sk", "sk": "sk", "israel": "he",
+	"il": "he",
+}
+
+// ImpliedLanguages returns the languages regions imply, in region order
+// without duplicates
+func ImpliedLanguages(regions []string) []string {
+	languages := make([]string, 0)
+	for _, region := range regions {
+		code, ok := regionLanguages[strings.ToLower(region)]
+		if ok && !slices.Contains(languages, code) {
+			languages = append(languages, code)
+		}
+	}
+	return languages
+}
+
+// GetVariantLanguages returns the language codes of a variant from the tags of
+// its name, or its filename when the name has neither regions nor languages.
+// Without language tags they are implied by the tagged regions, then by
+// region, the name of the variant's RegionID. implied is true when no
+// language was tagged.
+func GetVariantLanguages(tv TitleVariant, region string) (languages []string, implied bool) {
+	var tags FileTags
+	if tv.Name != "" {
+		tags = ParseFileTags(tv.Name)
+	}
+	if len(tags.Regions) == 0 && len(tags.Languages) == 0 {
+		tags = GetFileFragments(tv.Filename).Tags
+	}
+	if len(tags.Languages) > 0 {
+		return tags.Languages, false
+	}
+	regions := tags.Regions
+	if len(regions) == 0 && region != "" {
+		regions = []string{region}
+	}
+	return ImpliedLanguages(regions), true
+}
+
+// GetVariantRegions returns the region names of a variant from the tags of
+// its name, or its filename when the name has no regions, followed by region,
+// the name of the variant's RegionID. Names may repeat as aliases, e.g. "US"
+// and "USA".
+func GetVariantRegions(tv TitleVariant, region string) []string {
+	var regions []string
+	if tv.Name != "" {
+		regions = ParseFileTags(tv.Name).Regions
+	}
+	if len(regions) == 0 {
+		regions = GetFileFragments(tv.Filename).Tags.Regions
+	}
+	if region != "" {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// ParseFileTags parses a name or filename without its extension
+func ParseFileTags(name string) FileTags {
+	var t FileTags
+	title := GetTitleFromName(name)
+	if m := tagTitleVer.FindStringSubmatch(title); m != nil {
+		t.Version = m[1]
+	}
+	if m := tagTitleRev.FindStringSubmatch(title); m != nil {
+		t.Revision = m[1]
+	}
+
+	// publisher is only looked for before the first region or language
+	placeSeen := false
+	for _, tag := range splitTags(name) {
+		if tag[0] == '[' && tag[len(tag)-1] == ']' {
+			t.parseBracket(tag)
+			continue
+		}
+		if tag[0] != '(' || tag[len(tag)-1] != ')' {
+			t.Leftovers = append(t.Leftovers, tag)
+			continue
+		}
+		c := strings.TrimSpace(tag[1 : len(tag)-1])
+		if t.parseRegions(c) || t.parseLanguages(c) {
+			placeSeen = true
+			continue
+		}
+		if t.parseParen(c) {
+			continue
+		}
+		if c == "-" {
+			// TOSEC unknown publisher
+			continue
+		}
+		if t.Publisher == "" && !placeSeen && isPublisher(c) {
+			t.Publisher = c
+			continue
+		}
+		t.Leftovers = append(t.Leftovers, tag)
+	}
+	return t
+}
+
+// splitTags returns every "(...)" and "[...]" after the title, nested brackets
+// stay in their outer tag. Stray text between tags is returned trimmed.
+func splitTags(name string) []string {
+	start := strings.IndexAny(name, "([")
+	if start < 0 {
+		return nil
+	}
+	tags := make([]string, 0)
+	s := name[start:]
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			break
+		}
+		if s[0] != '(' && s[0] != '[' {
+			end := strings.IndexAny(s, "([")
+			if end < 0 {
+				end = len(s)
+			}
+			tags = append(tags, strings.TrimSpace(s[:end]))
+			s = s[end:]
+			continue
+		}
+		open, shut := s[0], byte(')')
+		if open == '[' {
+			shut = ']'
+		}
+		depth, end := 0, len(s)
+		for i := 0; i < len(s); i++ {
+			if s[i] == open {
+				depth++
+			} else if s[i] == shut {
+				depth--
+				if depth == 0 {
+					end = i + 1
+					break
+				}
+			}
+		}
+		tags = append(tags, s[:end])
+		s = s[end:]
+	}
+	return tags
+}
+
+// isPublisher leaves out tags starting lower case, MAME set descriptions and
+// MAME "(World, 851115)" region and date tags
+func isPublisher(c string) bool {
+	if c == "" || (c[0] >= 'a' && c[0] <= 'z') {
+		return false
+	}
+	if region, _, ok := strings.Cut(c, ", "); ok && TagRegions[region] {
+		return false
+	}
+	return !tagNotPublisher.MatchString(c)
+}
+
+func (t *FileTags) parseRegions(c string) bool {
+	if tagTOSECRegion.MatchString(c) {
+		codes := strings.Split(c, "-")
+		known := true
+		for _, code := range codes {
+			known = known && TagCountryCodes[code]
+		}
+		if known {
+			t.Regions = append(t.Regions, codes...)
+			return true
+		}
+	}
+	regions := strings.Split(c, ", ")
+	for _, region := range regions {
+		if !TagRegions[region] {
+			return false
+		}
+	}
+	t.Regions = append(t.Regions, regions...)
+	return true
+}
+
+func (t *FileTags) parseLanguages(c string) bool {
+	if m := tagLangCount.FindStringSubmatch(c); m != nil && t.LanguageCount == 0 {
+		t.LanguageCount, _ = strconv.Atoi(m[1])
+		return true
+	}
+	var codes []string
+	switch {
+	case tagNoIntroLang.MatchString(c):
+		codes = strings.Split(strings.ToLower(c), ",")
+	case tagTOSECLang.MatchString(c):
+		codes = strings.Split(c, "-")
+	default:
+		return false
+	}
+	for _, code := range codes {
+		if !TagLanguages[code] {
+			return false
+		}
+	}
+	t.Languages = append(t.Languages, codes...)
+	return true
+}
+
+// parseParen handles every other "(...)" tag, returns false when unknown
+func (t *FileTags) parseParen(c string) bool {
+	if m := tagVersion.FindStringSubmatch(c); m != nil && t.Version == "" {
+		t.Version = m[1]
+		return true
+	}
+	if m := tagRevision.FindStringSubmatch(c); m != nil && t.Revision == "" {
+		t.Revision = m[1]
+		return true
+	}
+	if m := tagDisc.FindStringSubmatch(c); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			// TOSEC disk letters only count when there is no number
+			n = int(m[1][0]-'A') + 1
+			if t.Disc != 0 {
+				return true
+			}
+		}
+		t.Disc = n
+		if m[2] != "" {
+			t.DiscTotal, _ = strconv.Atoi(m[2])
+		}
+		return true
+	}
+	if m := tagAlt.FindStringSubmatch(c); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		t.DumpFlags = append(t.DumpFlags, DumpFlag{Flag: "a", Number: n})
+		return true
+	}
+	if m := tagHack.FindStringSubmatch(c); m != nil {
+		t.DumpFlags = append(t.DumpFlags, DumpFlag{Flag: "h", Info: m[1]})
+		return true
+	}
+	if m := tagStatus.FindStringSubmatch(c); m != nil {
+		t.Status = append(t.Status, tagStatusNames[strings.ToLower(m[1])])
+		return true
+	}
+	if tagDate.MatchString(c) && t.Date == "" {
+		t.Date = c
+		return true
+	}
+	return false
+}
+
+func (t *FileTags) parseBracket(tag string) {
+	c := strings.TrimSpace(tag[1 : len(tag)-1])
+	// "[v1.0]" is a version, the TOSEC virus flag is a plain "[v]"
+	if m := tagBracketVer.FindStringSubmatch(c); m != nil {
+		if t.Version == "" {
+			t.Version = m[1]
+		} else {
+			t.Leftovers = append(t.Leftovers, tag)
+		}
+		return
+	}
+	m := tagDumpFlag.FindStringSubmatch(c)
+	if m == nil {
+		t.Leftovers = append(t.Leftovers, tag)
+		return
+	}
+	n, _ := strconv.Atoi(m[2])
+	t.DumpFlags = append(t.DumpFlags, DumpFlag{Flag: m[1], Number: n, Info: m[3]})
+}
@@ -0,0 +1,121 @@
+package ztdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testdata/tagcorpus.ndjson holds names drawn from db/ with their tags checked
+// by hand, one {"name": ..., "tags": ...} per line. Add a name with the parse
+// it should have when fixing the parser, never copy the parser's output in.
+const tagCorpusPath = "testdata/tagcorpus.ndjson"
+
+type tagCorpusEntry struct {
+	Name string   `json:"name"`
+	Tags FileTags `json:"tags"`
+}
+
+func TestParseFileTagsCorpus(t *testing.T) {
+	f, err := os.Open(tagCorpusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		var entry tagCorpusEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			t.Fatalf("line %v: %v", n, err)
+		}
+		got := ParseFileTags(entry.Name)
+		if !reflect.DeepEqual(normalTags(got), normalTags(entry.Tags)) {
+			want, _ := json.Marshal(entry.Tags)
+			gotJSON, _ := json.Marshal(got)
+			t.Errorf("ParseFileTags(%q)\n got  %s\n want %s", entry.Name, gotJSON, want)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("empty corpus")
+	}
+}
+
+// normalTags makes empty slices nil so omitted JSON fields compare equal
+func normalTags(t FileTags) FileTags {
+	if len(t.Regions) == 0 {
+		t.Regions = nil
+	}
+	if len(t.Languages) == 0 {
+		t.Languages = nil
+	}
+	if len(t.DumpFlags) == 0 {
+		t.DumpFlags = nil
+	}
+	if len(t.Status) == 0 {
+		t.Status = nil
+	}
+	if len(t.Leftovers) == 0 {
+		t.Leftovers = nil
+	}
+	return t
+}
+
+func TestParseFileTags(t *testing.T) {
+	tests := []struct {
+		name string
+		want FileTags
+	}{
+		{
+			"Legend of Zelda, The (USA, Europe) (En,Fr,De) (Rev 1) (Beta)",
+			FileTags{
+				Regions:   []string{"USA", "Europe"},
+				Languages: []string{"en", "fr", "de"},
+				Revision:  "1",
+				Status:    []string{"Beta"},
+			},
+		},
+		{
+			"Black Land v1.1 (1991-05)(Bollaware)(de)(Disk 1 of 2)[cr XOR][t +2]",
+			FileTags{
+				Languages: []string{"de"},
+				Version:   "1.1",
+				Disc:      1,
+				DiscTotal: 2,
+				DumpFlags: []DumpFlag{{Flag: "cr", Info: "XOR"}, {Flag: "t", Info: "+2"}},
+				Date:      "1991-05",
+				Publisher: "Bollaware",
+			},
+		},
+		{
+			"Smurfs, The (M3)[!]",
+			FileTags{LanguageCount: 3, DumpFlags: []DumpFlag{{Flag: "!"}}},
+		},
+		{
+			"1942 (Small) (World) (Aftermarket) (Unl)",
+			FileTags{
+				Regions:   []string{"World"},
+				Status:    []string{"Aftermarket", "Unl"},
+				Leftovers: []string{"(Small)"},
+			},
+		},
+		{
+			"Gun.Smoke (World, 851115) (bootleg)",
+			FileTags{Status: []string{"Bootleg"}, Leftovers: []string{"(World, 851115)"}},
+		},
+	}
+	for _, tt := range tests {
+		got := ParseFileTags(tt.name)
+		if !reflect.DeepEqual(normalTags(got), normalTags(tt.want)) {
+			t.Errorf("ParseFileTags(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -10,7 +10,7 @@ type FileFragments struct {
 	FileNameNoExt string
 	Title         string
 	Ext           string
-	//Tags     []string
+	Tags          FileTags
 }
 
 func GetTitleFromName(filename string) string {
@@ -22,8 +22,98 @@ func GetTitleFromName(filename string) string {
 	return strings.TrimSpace(title)
 }
 
+// GetTitleFromVariant is the title a variant is grouped under, taken from its
+// name or its filename when it has no name
+func GetTitleFromVariant(tv TitleVariant) string {
+	name := tv.Name
+	if name == "" {
+		name = GetFileFragments(tv.Filename).FileNameNoExt
+	}
+	return GetTitleFromName(name)
+}
+
+var (
+	workKeyArticle = regexp.MustCompile(`^(the|a|an) |, (the|a|an)( -|:|$)`)
+	workKeyWord    = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	workKeyRoman   = map[string]string{
+		"ii": "2", "iii": "3", "iv": "4", "v": "5", "vi": "6", "vii": "7", "viii": "8", "ix": "9",
+	}
+)
+
+// GetWorkKey normalises a title so the same game matches across systems and
+// naming conventions. Case, punctuation, apostrophes, "&", a leading or
+// trailing article and roman numerals II to IX in sequel position are
+// ignored, so "Legend of Zelda, The" matches "The Legend of Zelda" and "Street
+// Fighter II' - Champion Edition" matches "Street Fighter 2 - Champion
+// Edition". A numeral is in sequel position when it's a word of its own after
+// the first, "V" only when it ends the title or comes before a subtitle since
+// it's also a letter, "Alien v Predator" and "V-Rally" keep theirs.
+func GetWorkKey(title string) string {
+	s := strings.ToLower(title)
+	s = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(s)
+	s = workKeyArticle.ReplaceAllString(s, "$3")
+	spans := workKeyWord.FindAllStringIndex(s, -1)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = s[span[0]:span[1]]
+		if n, ok := workKeyRoman[words[i]]; ok && i > 0 && isSequel(s, spans, i) {
+			words[i] = n
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// isSequel reports whether word i of s is a numeral in sequel position, see
+// GetWorkKey
+func isSequel(s string, spans [][]int, i int) bool {
+	before := s[spans[i-1][1]:spans[i][0]]
+	if !strings.HasSuffix(before, " ") {
+		return false
+	}
+	if i == len(spans)-1 {
+		return true
+	}
+	after := s[spans[i][1]:spans[i+1][0]]
+	if strings.HasPrefix(after, "-") {
+		return false
+	}
+	return s[spans[i][0]:spans[i][1]] != "v" || strings.ContainsAny(after, "-:")
+}
+
+// CompactNames clears the name and description of a new variant when they
+// repeat its filename or name, the way the NDJSON stores them. FullNames
+// gives them back.
+func (tv *TitleVariant) CompactNames() {
+	frag := GetFileFragments(tv.Filename)
+	if tv.Name == tv.Filename || tv.Name == frag.FileNameNoExt {
+		tv.Name = ""
+	}
+	name, _ := tv.FullNames()
+	if tv.Description == "" {
+		tv.NoDescription = true
+	} else if tv.Description == name {
+		tv.Description = ""
+	}
+}
+
+// FullNames returns the name and description CompactNames cleared, the
+// description stays empty when the source had none
+func (tv TitleVariant) FullNames() (name, description string) {
+	name = tv.Name
+	if name == "" {
+		name = GetFileFragments(tv.Filename).FileNameNoExt
+	}
+	description = tv.Description
+	if description == "" && !tv.NoDescription {
+		description = name
+	}
+	return name, description
+}
+
+// GetTagsFromFileName returns every tag split on commas and lowercased, see
+// ParseFileTags for what they mean
 func GetTagsFromFileName(filename string) []string {
-	re := regexp.MustCompile(`\(([\w\,\- ]*)\)|\[([\w\,\- ]*)\]`)
+	re := regexp.MustCompile(`\(([^()]*)\)|\[([^\[\]]*)\]`)
 	matches := re.FindAllString(filename, -1)
 	tags := make([]string, 0)
 	for _, padded := range matches {
@@ -42,6 +132,22 @@ func GetFileFragments(filename string) FileFragments {
 	f.Ext = strings.ToLower(filepath.Ext(filename))
 	f.FileNameNoExt, _ = strings.CutSuffix(filename, f.Ext)
 	f.Title = GetTitleFromName(f.FileNameNoExt)
-	//f.Tags = getTagsFromFileName(f.FileName)
+	f.Tags = ParseFileTags(f.FileNameNoExt)
 	return f
 }
+
+// GetLanguagesFromFileName returns the lowercase language codes of No-Intro
+// "(En,Fr,De)" and TOSEC "(en-de)" tags. Upper case TOSEC tags are countries.
+func GetLanguagesFromFileName(filename string) []string {
+	re := regexp.MustCompile(`\(([A-Za-z]{2}(?:[,\-+][A-Za-z]{2})*)\)`)
+	languages := make([]string, 0)
+	for _, m := range re.FindAllStringSubmatch(filename, -1) {
+		for _, code := range regexp.MustCompile(`[,\-+]`).Split(m[1], -1) {
+			if code == strings.ToUpper(code) {
+				continue
+			}
+			languages = append(languages, strings.ToLower(code))
+		}
+	}
+	return languages
+}
@@ -0,0 +1,76 @@
+package ztdb
+
+import "testing"
+
+func TestCompactNames(t *testing.T) {
+	tests := []struct {
+		tv                TitleVariant
+		stored            TitleVariant
+		name, description string
+	}{
+		{
+			TitleVariant{Filename: "Tetris (World).gb", Name: "Tetris (World)", Description: "Tetris (World)"},
+			TitleVariant{Filename: "Tetris (World).gb"},
+			"Tetris (World)", "Tetris (World)",
+		},
+		{
+			TitleVariant{Filename: "Tetris (World).gb", Name: "Tetris (World)"},
+			TitleVariant{Filename: "Tetris (World).gb", NoDescription: true},
+			"Tetris (World)", "",
+		},
+		{
+			// a description equal to the filename isn't the name, it's kept
+			TitleVariant{Filename: "Tetris (World).gb", Name: "Tetris (World)", Description: "Tetris (World).gb"},
+			TitleVariant{Filename: "Tetris (World).gb", Description: "Tetris (World).gb"},
+			"Tetris (World)", "Tetris (World).gb",
+		},
+		{
+			TitleVariant{Filename: "tetris.gb", Name: "Tetris (World)", Description: "Tetris (World)"},
+			TitleVariant{Filename: "tetris.gb", Name: "Tetris (World)"},
+			"Tetris (World)", "Tetris (World)",
+		},
+	}
+	for _, tt := range tests {
+		tv := tt.tv
+		tv.CompactNames()
+		if tv != tt.stored {
+			t.Errorf("CompactNames(%+v) = %+v, want %+v", tt.tv, tv, tt.stored)
+		}
+		name, description := tv.FullNames()
+		if name != tt.name || description != tt.description {
+			t.Errorf("FullNames() = %q, %q, want %q, %q", name, description, tt.name, tt.description)
+		}
+	}
+}
+
+func TestGetWorkKey(t *testing.T) {
+	tests := []struct {
+		title, key string
+	}{
+		{"Legend of Zelda, The", "legend of zelda"},
+		{"The Legend of Zelda", "legend of zelda"},
+		{"Legend of Zelda, The - A Link to the Past", "legend of zelda a link to the past"},
+		{"Street Fighter II' - Champion Edition", "street fighter 2 champion edition"},
+		{"Street Fighter 2 - Champion Edition", "street fighter 2 champion edition"},
+		{"Final Fantasy VII: Crisis Core", "final fantasy 7 crisis core"},
+		{"Rocky V", "rocky 5"},
+		{"Tom & Jerry", "tom and jerry"},
+		{"Street Fighter II Champion Edition", "street fighter 2 champion edition"},
+		{"Quake III Arena", "quake 3 arena"},
+		{"Ultima V - Warriors of Destiny", "ultima 5 warriors of destiny"},
+		// "V" is only a numeral ending the title or before a subtitle
+		{"Alien v Predator", "alien v predator"},
+		{"Mega Man V Special", "mega man v special"},
+		{"Yu-Gi-Oh! ARC-V Tag Force", "yu gi oh arc v tag force"},
+		{"V-Rally", "v rally"},
+		{"V-Rally 3", "v rally 3"},
+		// numerals joined to another word or starting the title are kept
+		{"Gradius II-Gofer", "gradius ii gofer"},
+		{"Vi", "vi"},
+	}
+	for _, tt := range tests {
+		if key := GetWorkKey(tt.title); key != tt.key {
+			t.Errorf("GetWorkKey(%q) = %q, want %q", tt.title, key, tt.key)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ztdb
+
+import (
+	"regexp"
+	"strings"
+)
+
+/*
+Version ordering for variants of the same title. A variant's version and
+revision come from the NDJSON when set by hand and are parsed from its name
+otherwise, ParseFileTags. VersionKey turns them into a string that compares
+like the versions do, so the latest revision of a title sorts last.
+*/
+
+var versionPart = regexp.MustCompile(`\d+|[a-z]+`)
+
+// versionDigits pads every number in a key, longer numbers keep their digits
+const versionDigits = 12
+
+// VersionKey returns a key ordering variants by version, then revision, as
+// plain strings. Numbers compare by value and before letters, so "1" <
+// "1.1" < "1.10" < "1a" and "Rev A" < "Rev B". An unversioned variant sorts
+// before every version and an unrevised one before every revision.
+func VersionKey(version string, revision string) string {
+	return versionKeyPart(version) + "-" + versionKeyPart(revision)
+}
+
+func versionKeyPart(s string) string {
+	parts := versionPart.FindAllString(strings.ToLower(s), -1)
+	for i, part := range parts {
+		if part[0] >= '0' && part[0] <= '9' {
+			part = strings.TrimLeft(part, "0")
+			if len(part) < versionDigits {
+				part = strings.Repeat("0", versionDigits-len(part)) + part
+			}
+			parts[i] = part
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// FillVersions sets Version and Revision of every variant that has neither
+// from the tags of its name, or its filename when the name has none. Returns
+// how many variants were filled.
+func FillVersions(tvs []TitleVariant) int {
+	filled := 0
+	for i, tv := range tvs {
+		if tv.Version != "" || tv.Revision != "" {
+			continue
+		}
+		var tags FileTags
+		if tv.Name != "" {
+			tags = ParseFileTags(tv.Name)
+		}
+		if tags.Version == "" && tags.Revision == "" {
+			tags = GetFileFragments(tv.Filename).Tags
+		}
+		if tags.Version == "" && tags.Revision == "" {
+			continue
+		}
+		tvs[i].Version = tags.Version
+		tvs[i].Revision = tags.Revision
+		filled++
+	}
+	return filled
+}